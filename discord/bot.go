@@ -7,36 +7,67 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 	"zundago/dns"
-
-	"golang.org/x/crypto/nacl/secretbox"
+	"zundago/socket"
 )
 
 const (
 	HOST = "https://discord.com/api/v10/"
 )
 
+const (
+	epoch    = 1420070400000
+	lifetime = time.Minute * 15
+	updates  = 5
+	window   = time.Second * 20
+)
+
 const (
 	ready             = "READY"
+	resumed           = "RESUMED"
 	messageCreate     = "MESSAGE_CREATE"
+	messageUpdate     = "MESSAGE_UPDATE"
+	messageDelete     = "MESSAGE_DELETE"
+	reactionAdd       = "MESSAGE_REACTION_ADD"
+	typingStart       = "TYPING_START"
 	guildCreate       = "GUILD_CREATE"
 	guildUpdate       = "GUILD_UPDATE"
 	guildDelete       = "GUILD_DELETE"
+	guildMemberAdd    = "GUILD_MEMBER_ADD"
+	guildMemberUpdate = "GUILD_MEMBER_UPDATE"
+	guildMemberRemove = "GUILD_MEMBER_REMOVE"
+	guildRoleCreate   = "GUILD_ROLE_CREATE"
+	guildRoleUpdate   = "GUILD_ROLE_UPDATE"
+	guildRoleDelete   = "GUILD_ROLE_DELETE"
+	channelCreate     = "CHANNEL_CREATE"
+	channelUpdate     = "CHANNEL_UPDATE"
+	channelDelete     = "CHANNEL_DELETE"
+	threadCreate      = "THREAD_CREATE"
+	threadUpdate      = "THREAD_UPDATE"
+	threadDelete      = "THREAD_DELETE"
+	threadListSync    = "THREAD_LIST_SYNC"
+	threadMember      = "THREAD_MEMBER_UPDATE"
+	threadMembers     = "THREAD_MEMBERS_UPDATE"
 	interactionCreate = "INTERACTION_CREATE"
 	guildMembersChunk = "GUILD_MEMBERS_CHUNK"
+	presenceUpdate    = "PRESENCE_UPDATE"
 	voiceServerUpdate = "VOICE_SERVER_UPDATE"
 	voiceStateUpdate  = "VOICE_STATE_UPDATE"
 )
 
 const (
-	StringOption int = iota + 3
+	SubcommandOption int = iota + 1
+	SubcommandGroupOption
+	StringOption
 	IntOption
 	BoolOption
 	UserOption
@@ -47,11 +78,19 @@ const (
 	AttachmentOption
 )
 
+const (
+	VoiceResumed VoiceEventType = iota
+	VoiceReconnected
+	VoiceMoved
+	VoiceClosed
+)
+
 const (
 	Playing ActivityType = iota
 	Streaming
 	Listening
 	Watching
+	Custom
 	Competing
 )
 
@@ -93,15 +132,36 @@ const (
 	ModalSubmit
 )
 
+const (
+	RowComponent int = iota + 1
+	ButtonComponent
+	StringSelectComponent
+	TextInputComponent
+	UserSelectComponent
+	RoleSelectComponent
+	MentionableSelectComponent
+	ChannelSelectComponent
+)
+
+const (
+	PrimaryButton int = iota + 1
+	SecondaryButton
+	SuccessButton
+	DangerButton
+	LinkButton
+)
+
+const (
+	ShortInput int = iota + 1
+	ParagraphInput
+)
+
 var (
-	Global = &glob{
-		Guilds:   make(map[string]*Guild),
-		Channels: make(map[string]*Channel),
-		Voices:   make(map[string]*Voice),
-	}
+	Global   = newState()
 	resolver = dns.New()
 	client   = &http.Client{
 		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
 			DialContext:         resolver.Dial(),
 			MaxIdleConnsPerHost: 50,
 			MaxConnsPerHost:     25,
@@ -112,48 +172,116 @@ var (
 
 func New(intent Intent) *Session {
 	return &Session{
-		sock: &sock{
-			intt: int(intent),
-			lock: true,
-		},
+		intt: int(intent),
 	}
 }
 
 func (sess *Session) Start(tok string) error {
+	return sess.start(tok)
+}
 
-	if sess.Cached {
-		sess.sock.mem = true
-	}
-
-	if sess.Presence.Activity.Name != "" {
-		sess.sock.pres = sess.Presence
+func (sess *Session) Close() error {
+	if len(sess.socks) == 0 {
+		return errors.New("session not started")
 	}
 
-	sess.sock.sec = tok
+	err := sess.end(1000)
+	Global.reset()
 
-	sess.sock.que = sess.Commands
-	sess.sock.list = sess.Listeners
+	select {
+	case sess.quit <- true:
+	default:
+	}
 
-	return sess.sock.start()
+	return err
 }
 
 func (sess *Session) Connect(guild string, channel string, mute bool, deaf bool) (*Voice, error) {
-	return sess.sock.connect(guild, channel, mute, deaf)
+	sock := sess.route(guild)
+	if sock == nil {
+		return nil, errors.New("session not started")
+	}
+
+	return sock.connect(guild, channel, mute, deaf)
 }
 
 func (sess *Session) Disconnect(guild string) error {
-	return sess.sock.disconnect(guild)
+	sock := sess.route(guild)
+	if sock == nil {
+		return errors.New("session not started")
+	}
+
+	return sock.disconnect(guild)
+}
+
+func (sess *Session) SetPresence(pres Presence) error {
+	if len(sess.socks) == 0 {
+		return errors.New("session not started")
+	}
+
+	var errs []error
+	for _, sock := range sess.socks {
+		err := sock.presence(pres)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	msgs := make([]string, len(errs))
+	for idx := range errs {
+		msgs[idx] = errs[idx].Error()
+	}
+
+	return errors.New("presence update failed on " + strconv.Itoa(len(errs)) + " shards: " + strings.Join(msgs, "; "))
+}
+
+func (sess *Session) CurrentPresence() Presence {
+	if len(sess.socks) == 0 {
+		return sess.Presence
+	}
+
+	sock := sess.socks[0]
+
+	sock.mutex.Lock()
+	defer sock.mutex.Unlock()
+
+	return sock.pres
+}
+
+func (sess *Session) RequestMembers(guild string, query string, users []string) ([]Member, error) {
+	sock := sess.route(guild)
+	if sock == nil {
+		return nil, errors.New("session not started")
+	}
+
+	return sock.members(guild, query, users)
 }
 
 func (voice *Voice) Speak(speak bool) error {
 
+	voice.mutex.Lock()
+	conn := voice.conn
+	ssrc := voice.two.SSRC
+	voice.mutex.Unlock()
+
+	if conn == nil {
+		return errors.New("voice connection closed")
+	}
+
 	dat := map[string]interface{}{
 		"speaking": speak,
 		"delay":    0,
-		"ssrc":     voice.two.SSRC,
+		"ssrc":     ssrc,
 	}
 
-	err := voice.conn.WriteJSON(map[string]interface{}{"op": 5, "d": dat})
+	err := conn.WriteJSON(map[string]interface{}{"op": 5, "d": dat})
 	if err != nil {
 		return err
 	}
@@ -161,225 +289,604 @@ func (voice *Voice) Speak(speak bool) error {
 	return nil
 }
 
-func (voice *Voice) event() {
+func (voice *Voice) open(resume bool) error {
+	endpoint := voice.endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "wss://" + endpoint
+	}
+
+	conn, err := voice.dialer.Dial(endpoint+"/?v=4", nil)
+	if err != nil {
+		return err
+	}
+
+	voice.mutex.Lock()
+	if voice.done {
+		voice.mutex.Unlock()
+		conn.Close()
+		return errors.New("voice connection closed")
+	}
+	voice.conn = conn
+	voice.mutex.Unlock()
+
+	dat := map[string]interface{}{
+		"server_id":  voice.GuildId,
+		"session_id": voice.session,
+		"token":      voice.token,
+	}
+
+	op := 7
+	if !resume {
+		op = 0
+		dat["user_id"] = voice.user
+	}
+
+	err = conn.WriteJSON(map[string]interface{}{"op": op, "d": dat})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	go voice.event(conn)
+
+	return nil
+}
+
+func (voice *Voice) event(conn *socket.Conn) {
+	var udp *net.UDPConn
 
 	for {
 		msg := new(msg)
 
-		err := voice.conn.ReadJSON(msg)
+		err := conn.ReadJSON(msg)
 		if err != nil {
-			delete(Global.Voices, voice.GuildId)
-
-			if voice.udp != nil {
-				err := voice.udp.Close()
-				if err != nil {
-					voice.err <- err
-					return
-				}
+			if udp != nil {
+				udp.Close()
 			}
+			voice.drop(conn, err)
+			return
+		}
 
-			if voice.conn != nil {
-				err = voice.conn.Close()
-				if err != nil {
-					voice.err <- err
-					return
-				}
+		err = voice.handle(conn, msg, &udp)
+		if err != nil {
+			if udp != nil {
+				udp.Close()
 			}
+			conn.Close()
+			voice.drop(conn, err)
+			return
+		}
+	}
+}
 
-			if errors.Is(err, io.EOF) {
-				voice.err <- io.ErrUnexpectedEOF
-				return
-			}
+func (voice *Voice) handle(conn *socket.Conn, msg *msg, pending **net.UDPConn) error {
 
-			voice.err <- err
-			return
+	switch msg.Op {
+	case 2:
+		two := voice.two
+		err := json.Unmarshal(msg.D, &two)
+		if err != nil {
+			return err
 		}
 
-		switch msg.Op {
-		case 2:
-			err := json.Unmarshal(msg.D, &voice.two)
-			if err != nil {
-				voice.err <- err
-				return
-			}
+		voice.mutex.Lock()
+		voice.two = two
+		voice.mutex.Unlock()
 
-			host := net.JoinHostPort(voice.two.IP, strconv.Itoa(voice.two.Port))
+		host := net.JoinHostPort(two.IP, strconv.Itoa(two.Port))
 
-			adr, err := net.ResolveUDPAddr("udp", host)
-			if err != nil {
-				voice.err <- err
-				return
-			}
+		adr, err := net.ResolveUDPAddr("udp", host)
+		if err != nil {
+			return err
+		}
 
-			voice.udp, err = net.DialUDP("udp", nil, adr)
-			if err != nil {
-				voice.err <- err
-				return
-			}
+		udp, err := net.DialUDP("udp", nil, adr)
+		if err != nil {
+			return err
+		}
+		*pending = udp
 
-			ssrc := make([]byte, 70)
-			binary.BigEndian.PutUint32(ssrc, voice.two.SSRC)
+		ssrc := make([]byte, 70)
+		binary.BigEndian.PutUint32(ssrc, two.SSRC)
 
-			_, err = voice.udp.Write(ssrc)
-			if err != nil {
-				voice.err <- err
-				return
-			}
+		_, err = udp.Write(ssrc)
+		if err != nil {
+			return err
+		}
 
-			resp := make([]byte, 70)
-			ln, _, err := voice.udp.ReadFromUDP(resp)
-			if err != nil {
-				voice.err <- err
-				return
+		resp := make([]byte, 70)
+		ln, _, err := udp.ReadFromUDP(resp)
+		if err != nil {
+			return err
+		}
+		if ln < 70 {
+			return errors.New("received a small udp packet")
+		}
+
+		var ip []byte
+		for idx, byt := range resp {
+			if byt == 0 {
+				break
 			}
-			if ln < 70 {
-				voice.err <- errors.New("received a small udp packet")
-				return
+			if idx+1 == len(resp) {
+				return errors.New("no termination character")
 			}
+			ip = append(ip, byt)
+		}
+
+		port := binary.BigEndian.Uint16(resp[68:70])
 
-			var ip []byte
-			for idx, byt := range resp {
-				if byt == 0 {
-					break
-				}
-				if idx+1 == len(resp) {
-					voice.err <- errors.New("no termination character")
-					return
-				}
-				ip = append(ip, byt)
+		mode, err := selectMode(two.Modes)
+		if err != nil {
+			return err
+		}
+
+		dat := map[string]interface{}{
+			"protocol": "udp",
+			"data": map[string]interface{}{
+				"address": string(ip),
+				"port":    port,
+				"mode":    mode,
+			},
+		}
+
+		return conn.WriteJSON(map[string]interface{}{"op": 1, "d": dat})
+
+	case 3:
+	case 4:
+		four := voice.four
+		err := json.Unmarshal(msg.D, &four)
+		if err != nil {
+			return err
+		}
+
+		crypt, err := newCrypt(four.Mode, four.SecretKey)
+		if err != nil {
+			return err
+		}
+
+		udp := *pending
+		if udp == nil {
+			return errors.New("session description before udp discovery")
+		}
+		*pending = nil
+
+		voice.mutex.Lock()
+		old := voice.udp
+		voice.udp = udp
+		voice.four = four
+		voice.crypt = crypt
+		voice.tries = 0
+		live := voice.live
+		start := !voice.sending
+		voice.sending = true
+		voice.mutex.Unlock()
+
+		if old != nil {
+			old.Close()
+		}
+
+		if start {
+			go voice.send()
+		}
+		go voice.recv(udp)
+
+		select {
+		case voice.ready <- true:
+		default:
+		}
+
+		if live {
+			voice.emit(VoiceReconnected, nil)
+		}
+
+	case 5:
+		speak := new(speaking)
+		err := json.Unmarshal(msg.D, speak)
+		if err != nil {
+			return err
+		}
+
+		voice.mutex.Lock()
+		voice.ssrcs[speak.SSRC] = speak.UserId
+		voice.mutex.Unlock()
+
+	case 8:
+		hello := new(hello)
+		err := json.Unmarshal(msg.D, hello)
+		if err != nil {
+			return err
+		}
+
+		go voice.beat(conn, time.Millisecond*time.Duration(hello.HeartbeatInterval))
+
+	case 9:
+		voice.mutex.Lock()
+		voice.tries = 0
+		voice.mutex.Unlock()
+
+		voice.emit(VoiceResumed, nil)
+
+	case 13:
+		speak := new(speaking)
+		err := json.Unmarshal(msg.D, speak)
+		if err != nil {
+			return err
+		}
+
+		voice.mutex.Lock()
+		for ssrc, user := range voice.ssrcs {
+			if user == speak.UserId {
+				delete(voice.ssrcs, ssrc)
 			}
+		}
+		voice.mutex.Unlock()
+	}
+
+	return nil
+}
+
+func (voice *Voice) beat(conn *socket.Conn, interval time.Duration) {
+	for {
+		voice.mutex.Lock()
+		cur := voice.conn
+		voice.mutex.Unlock()
+
+		if cur != conn {
+			return
+		}
+
+		err := conn.WriteJSON(map[string]interface{}{"op": 3, "d": time.Now().Unix()})
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-voice.quit:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (voice *Voice) drop(conn *socket.Conn, err error) {
+
+	voice.mutex.Lock()
+	stale := voice.done || voice.conn != conn
+	live := voice.live
+	voice.mutex.Unlock()
 
-			port := binary.BigEndian.Uint16(resp[68:70])
+	if stale {
+		return
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if !live {
+		select {
+		case voice.err <- err:
+		default:
+		}
+		return
+	}
+
+	resume := true
+
+	var closed *socket.CloseError
+	if errors.As(err, &closed) {
+		switch closed.Code {
+		case 4014:
+			return
+		case 4004, 4011, 4012, 4016:
+			voice.end(closed)
+			return
+		case 4006, 4009:
+			resume = false
+		}
+	}
 
-			dat := map[string]interface{}{
-				"protocol": "udp",
-				"data": map[string]interface{}{
-					"address": string(ip),
-					"port":    port,
-					"mode":    "xsalsa20_poly1305",
-				},
+	voice.reconnect(resume)
+}
+
+func (voice *Voice) reconnect(resume bool) {
+	select {
+	case voice.kick <- resume:
+	default:
+	}
+}
+
+func (voice *Voice) supervise() {
+	for {
+		var resume bool
+
+		select {
+		case <-voice.quit:
+			return
+		case resume = <-voice.kick:
+		}
+
+		for {
+			select {
+			case more := <-voice.kick:
+				resume = resume && more
+			default:
 			}
 
-			err = voice.conn.WriteJSON(map[string]interface{}{"op": 1, "d": dat})
-			if err != nil {
-				voice.err <- err
+			voice.mutex.Lock()
+			tries := voice.tries
+			voice.tries++
+			voice.mutex.Unlock()
+
+			if tries >= 5 {
+				voice.end(errors.New("voice reconnect attempts exhausted"))
 				return
 			}
 
-		case 3:
-		case 4:
-
-			err := json.Unmarshal(msg.D, &voice.four)
-			if err != nil {
-				voice.err <- err
+			wait := time.Second << tries
+			select {
+			case <-voice.quit:
 				return
+			case <-time.After(wait/2 + time.Duration(rand.Int63n(int64(wait/2)))):
 			}
 
-			if voice.Send == nil {
-				voice.Send = make(chan []byte)
+			err := voice.open(resume)
+			if err == nil {
+				break
 			}
+		}
+	}
+}
 
-			voice.ready <- true
+func (voice *Voice) update(state *VoiceState) {
 
-			go voice.send()
+	voice.mutex.Lock()
+	if !voice.live {
+		voice.mutex.Unlock()
 
-		case 8:
-			hello := new(hello)
-			err := json.Unmarshal(msg.D, hello)
-			if err != nil {
-				voice.err <- err
-				return
-			}
+		select {
+		case voice.state <- state:
+		default:
+		}
+		return
+	}
 
-			go func() {
-				for {
-					if voice.conn == nil {
-						return
-					}
+	voice.session = state.SessionID
+	moved := state.ChannelID != "" && state.ChannelID != voice.channelId
+	if moved {
+		voice.channelId = state.ChannelID
+	}
+	voice.mutex.Unlock()
 
-					err = voice.conn.WriteJSON(map[string]interface{}{"op": 3, "d": time.Now().Unix()})
-					if err != nil {
-						voice.err <- err
-						return
-					}
+	if state.ChannelID == "" {
+		voice.end(errors.New("disconnected from voice channel"))
+		return
+	}
 
-					time.Sleep(time.Millisecond * time.Duration(hello.HeartbeatInterval))
-				}
-			}()
+	if moved {
+		voice.emit(VoiceMoved, nil)
+	}
+}
+
+func (voice *Voice) move(update *VoiceServerUpdate) {
+
+	voice.mutex.Lock()
+	if !voice.live {
+		voice.mutex.Unlock()
+
+		select {
+		case voice.server <- update:
+		default:
 		}
+		return
+	}
+
+	if update.Endpoint == "" {
+		voice.mutex.Unlock()
+		return
+	}
+
+	voice.token = update.Token
+	voice.endpoint = update.Endpoint
+	conn := voice.conn
+	voice.conn = nil
+	voice.tries = 0
+	voice.mutex.Unlock()
+
+	if conn != nil {
+		go func() {
+			conn.WriteClose(1000)
+			conn.Close()
+		}()
+	}
+
+	voice.reconnect(false)
+}
+
+func (voice *Voice) emit(typ VoiceEventType, err error) {
+
+	voice.mutex.Lock()
+	defer voice.mutex.Unlock()
+
+	if voice.done {
+		return
+	}
+
+	select {
+	case voice.Events <- &VoiceEvent{Type: typ, ChannelId: voice.channelId, Err: err}:
+	default:
+	}
+}
+
+func (voice *Voice) end(err error) {
+
+	voice.mutex.Lock()
+	if voice.done {
+		voice.mutex.Unlock()
+		return
+	}
+
+	select {
+	case voice.Events <- &VoiceEvent{Type: VoiceClosed, ChannelId: voice.channelId, Err: err}:
+	default:
+	}
+
+	voice.done = true
+	close(voice.Events)
+	close(voice.quit)
+	for user, pkts := range voice.users {
+		close(pkts)
+		delete(voice.users, user)
+	}
+
+	conn := voice.conn
+	udp := voice.udp
+	voice.conn = nil
+	voice.udp = nil
+	voice.mutex.Unlock()
+
+	if cur, ok := Global.Voice(voice.GuildId); ok && cur == voice {
+		Global.deleteVoice(voice.GuildId)
+	}
+
+	if conn != nil {
+		conn.WriteClose(1000)
+		conn.Close()
+	}
+
+	if udp != nil {
+		udp.Close()
 	}
 }
 
 func (voice *Voice) send() {
 	var seq uint16
 	var timestamp uint32
-	var nonce [24]byte
-
-	head := make([]byte, 12)
-	head[0] = 0x80
-	head[1] = 0x78
-	binary.BigEndian.PutUint32(head[8:], voice.two.SSRC)
 
 	tick := time.NewTicker(time.Millisecond * 20)
 	defer tick.Stop()
 	for {
-		opus, ok := <-voice.Send
-		if !ok {
+		var opus []byte
+		var ok bool
+
+		select {
+		case <-voice.quit:
 			return
+		case opus, ok = <-voice.Send:
+			if !ok {
+				return
+			}
 		}
 
+		voice.mutex.Lock()
+		udp := voice.udp
+		crypt := voice.crypt
+		ssrc := voice.two.SSRC
+		voice.mutex.Unlock()
+
+		head := make([]byte, 12)
+		head[0] = 0x80
+		head[1] = 0x78
+
 		binary.BigEndian.PutUint16(head[2:4], seq)
 		seq++
 
 		binary.BigEndian.PutUint32(head[4:8], timestamp)
 		timestamp += 960
 
-		copy(nonce[:], head)
-		buf := secretbox.Seal(head, opus, &nonce, &voice.four.SecretKey)
+		binary.BigEndian.PutUint32(head[8:12], ssrc)
+
+		buf := crypt.seal(head, opus)
 
 		<-tick.C
 
-		voice.udp.Write(buf)
+		if udp != nil {
+			udp.Write(buf)
+		}
 	}
 }
 
-func (int *Interaction) Reply(resp *Response) error {
-	route := fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
-	dat, err := resp.build()
-	if err != nil {
-		return err
-	}
+func (voice *Voice) ChannelId() string {
+	voice.mutex.Lock()
+	defer voice.mutex.Unlock()
 
-	body, boundary, err := multiPart(map[string]interface{}{"type": 4, "data": dat}, resp.Files)
-	if err != nil {
-		return err
-	}
+	return voice.channelId
+}
 
-	req, err := http.NewRequest(http.MethodPost, HOST+route, body)
-	if err != nil {
-		return err
-	}
+func (voice *Voice) Done() <-chan struct{} {
+	return voice.quit
+}
 
-	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+func (voice *Voice) Receive(user string) <-chan *VoicePacket {
 
-	res, err := client.Do(req)
-	if err != nil {
-		return err
+	voice.mutex.Lock()
+	defer voice.mutex.Unlock()
+
+	pkts, ok := voice.users[user]
+	if !ok {
+		pkts = make(chan *VoicePacket, 64)
+		if voice.done {
+			close(pkts)
+			return pkts
+		}
+		voice.users[user] = pkts
 	}
 
-	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		err = new(Error)
-		json.NewDecoder(res.Body).Decode(err)
-		return err
+	return pkts
+}
+
+func (voice *Voice) recv(udp *net.UDPConn) {
+	buf := make([]byte, 1<<16)
+	for {
+		ln, err := udp.Read(buf)
+		if err != nil {
+			return
+		}
+
+		pkt := buf[:ln]
+		if ln < 12 || pkt[0]&0xc0 != 0x80 || pkt[1]&0x7f != 0x78 {
+			continue
+		}
+
+		voice.mutex.Lock()
+		crypt := voice.crypt
+		voice.mutex.Unlock()
+
+		data, ok := crypt.open(pkt)
+		if !ok {
+			continue
+		}
+
+		ssrc := binary.BigEndian.Uint32(pkt[8:12])
+
+		voice.mutex.Lock()
+		user, ok := voice.ssrcs[ssrc]
+		pkts := voice.users[user]
+		if ok && pkts != nil {
+			select {
+			case pkts <- &VoicePacket{
+				UserId:    user,
+				SSRC:      ssrc,
+				Sequence:  binary.BigEndian.Uint16(pkt[2:4]),
+				Timestamp: binary.BigEndian.Uint32(pkt[4:8]),
+				Opus:      data,
+			}:
+			default:
+			}
+		}
+		voice.mutex.Unlock()
 	}
+}
 
-	_, err = io.Copy(io.Discard, res.Body)
+func (int *Interaction) Reply(resp *Response) error {
+	route := fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
+	dat, err := resp.build()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return int.rest.multipart(http.MethodPost, route, map[string]interface{}{"type": 4, "data": dat}, resp.Files, nil)
 }
 
 func (int *Interaction) Defer(ephemeral bool) error {
@@ -397,121 +904,253 @@ func (int *Interaction) Defer(ephemeral bool) error {
 
 	route := fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
 
-	body := new(bytes.Buffer)
+	return int.rest.json(http.MethodPost, route, dat, nil)
+}
 
-	err := json.NewEncoder(body).Encode(dat)
+func (int *Interaction) Edit(resp *Response) error {
+	dat, err := resp.build()
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, HOST+route, body)
-	if err != nil {
-		return err
+	var route string
+	var method string
+
+	if int.Type == 2 {
+		route = fmt.Sprintf("webhooks/%s/%s/messages/@original", int.ApplicationId, int.Token)
+		method = http.MethodPatch
+	} else {
+		route = fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
+		method = http.MethodPost
+		dat = map[string]interface{}{"type": 7, "data": dat}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return int.rest.multipart(method, route, dat, resp.Files, nil)
+}
 
-	res, err := client.Do(req)
+func (int *Interaction) Modal(modal *Modal) error {
+	route := fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
+	dat, err := modal.build()
 	if err != nil {
 		return err
 	}
 
-	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		err = new(Error)
-		json.NewDecoder(res.Body).Decode(err)
-		return err
+	return int.rest.json(http.MethodPost, route, map[string]interface{}{"type": 9, "data": dat}, nil)
+}
+
+func (int *Interaction) Autocomplete(choices []Choice) error {
+	if choices == nil {
+		choices = []Choice{}
+	}
+	if len(choices) > 25 {
+		choices = choices[:25]
 	}
 
-	_, err = io.Copy(io.Discard, res.Body)
-	if err != nil {
-		return err
+	route := fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
+	dat := map[string]interface{}{
+		"type": 8,
+		"data": map[string]interface{}{"choices": choices},
+	}
+
+	return int.rest.json(http.MethodPost, route, dat, nil)
+}
+
+func (int *Interaction) Focused() *Option {
+	return focused(int.Data.Options)
+}
+
+func focused(opts []Option) *Option {
+	for idx := range opts {
+		if opts[idx].Focused {
+			return &opts[idx]
+		}
+
+		if opt := focused(opts[idx].Options); opt != nil {
+			return opt
+		}
 	}
 
 	return nil
 }
 
-func (int *Interaction) Edit(resp *Response) error {
+func (int Interaction) Delete() error {
+	route := fmt.Sprintf("webhooks/%s/%s/messages/@original", int.ApplicationId, int.Token)
+
+	return int.rest.json(http.MethodDelete, route, nil, nil)
+}
+
+func (int *Interaction) Expiry() time.Time {
+	id, _ := strconv.ParseInt(int.Id, 10, 64)
+
+	return time.UnixMilli(id>>22 + epoch).Add(lifetime)
+}
+
+func (int *Interaction) Expired() bool {
+	return time.Now().After(int.Expiry())
+}
+
+func (int *Interaction) Guild() (Guild, bool) {
+	return Global.Guild(int.GuildId)
+}
+
+func (int *Interaction) Followup(resp *Response) (*Message, error) {
+	if int.Expired() {
+		return nil, errors.New("interaction token expired")
+	}
+
 	dat, err := resp.build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var route string
-	var method string
+	route := fmt.Sprintf("webhooks/%s/%s", int.ApplicationId, int.Token)
 
-	if int.Type == 2 {
-		route = fmt.Sprintf("webhooks/%s/%s/messages/@original", int.ApplicationId, int.Token)
-		method = http.MethodPatch
-	} else {
-		route = fmt.Sprintf("interactions/%s/%s/callback", int.Id, int.Token)
-		method = http.MethodPost
-		dat = map[string]interface{}{"type": 7, "data": dat}
+	message := new(Message)
+	err = int.rest.multipart(http.MethodPost, route, dat, resp.Files, message)
+	if err != nil {
+		return nil, err
 	}
 
-	body, boundary, err := multiPart(dat, resp.Files)
-	if err != nil {
-		return err
+	return message, nil
+}
+
+func (int *Interaction) EditFollowup(id string, resp *Response) (*Message, error) {
+	if int.Expired() {
+		return nil, errors.New("interaction token expired")
 	}
 
-	req, err := http.NewRequest(method, HOST+route, body)
+	dat, err := resp.build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	route := fmt.Sprintf("webhooks/%s/%s/messages/%s", int.ApplicationId, int.Token, id)
 
-	res, err := client.Do(req)
+	message := new(Message)
+	err = int.rest.multipart(http.MethodPatch, route, dat, resp.Files, message)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		err = new(Error)
-		json.NewDecoder(res.Body).Decode(err)
-		return err
+	return message, nil
+}
+
+func (int *Interaction) DeleteFollowup(id string) error {
+	if int.Expired() {
+		return errors.New("interaction token expired")
 	}
 
-	_, err = io.Copy(io.Discard, res.Body)
+	route := fmt.Sprintf("webhooks/%s/%s/messages/%s", int.ApplicationId, int.Token, id)
+
+	return int.rest.json(http.MethodDelete, route, nil, nil)
+}
+
+func (int *Interaction) Input(id string) string {
+	for _, row := range int.Data.Components {
+		for _, comp := range row.Components {
+			if comp.CustomId == id {
+				return comp.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+func (sess *Session) SendMessage(channel string, resp *Response) (*Message, error) {
+	if sess.rest == nil {
+		return nil, errors.New("session not started")
+	}
+
+	dat, err := resp.build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	route := fmt.Sprintf("channels/%s/messages", channel)
+
+	message := new(Message)
+	err = sess.rest.multipart(http.MethodPost, route, dat, resp.Files, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
 }
 
-func (int Interaction) Delete() error {
-	route := fmt.Sprintf("webhooks/%s/%s/messages/@original", int.ApplicationId, int.Token)
+func (sess *Session) EditMessage(channel string, id string, resp *Response) (*Message, error) {
+	if sess.rest == nil {
+		return nil, errors.New("session not started")
+	}
 
-	req, err := http.NewRequest(http.MethodDelete, HOST+route, nil)
+	dat, err := resp.build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	route := fmt.Sprintf("channels/%s/messages/%s", channel, id)
 
-	res, err := client.Do(req)
+	message := new(Message)
+	err = sess.rest.multipart(http.MethodPatch, route, dat, resp.Files, message)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		err = new(Error)
-		json.NewDecoder(res.Body).Decode(err)
-		return err
+	return message, nil
+}
+
+func (sess *Session) DeleteMessage(channel string, id string) error {
+	if sess.rest == nil {
+		return errors.New("session not started")
+	}
+
+	route := fmt.Sprintf("channels/%s/messages/%s", channel, id)
+
+	return sess.rest.json(http.MethodDelete, route, nil, nil)
+}
+
+func (sess *Session) AddReaction(channel string, id string, emoji string) error {
+	if sess.rest == nil {
+		return errors.New("session not started")
+	}
+
+	route := fmt.Sprintf("channels/%s/messages/%s/reactions/%s/@me", channel, id, url.PathEscape(emoji))
+
+	return sess.rest.json(http.MethodPut, route, nil, nil)
+}
+
+func (sess *Session) Execute(hook *Webhook, resp *Response) (*Message, error) {
+	if sess.rest == nil {
+		return nil, errors.New("session not started")
 	}
 
-	_, err = io.Copy(io.Discard, res.Body)
+	dat, err := resp.build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if hook.Username != "" {
+		dat["username"] = hook.Username
+	}
+	if hook.AvatarURL != "" {
+		dat["avatar_url"] = hook.AvatarURL
+	}
+
+	route := fmt.Sprintf("webhooks/%s/%s?wait=true", hook.Id, hook.Token)
+	if hook.ThreadId != "" {
+		route += "&thread_id=" + hook.ThreadId
+	}
+
+	message := new(Message)
+	err = sess.rest.multipart(http.MethodPost, route, dat, resp.Files, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
 }
 
-func multiPart(dat map[string]interface{}, fls []File) (io.Reader, string, error) {
+func multiPart(dat map[string]interface{}, fls []File) ([]byte, string, error) {
 	var buf bytes.Buffer
 
 	wrt := multipart.NewWriter(&buf)
@@ -558,5 +1197,5 @@ func multiPart(dat map[string]interface{}, fls []File) (io.Reader, string, error
 
 	wrt.Close()
 
-	return &buf, wrt.Boundary(), nil
+	return buf.Bytes(), wrt.Boundary(), nil
 }
@@ -2,9 +2,23 @@ package discord
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 )
 
+var (
+	populated = map[string]bool{
+		"id":                         true,
+		"application_id":             true,
+		"version":                    true,
+		"guild_id":                   true,
+		"default_member_permissions": true,
+		"default_permission":         true,
+		"integration_types":          true,
+		"contexts":                   true,
+	}
+)
+
 func (opt *Option) build() map[string]interface{} {
 	body := map[string]interface{}{
 		"name":        opt.Name,
@@ -32,16 +46,19 @@ func (opt *Option) build() map[string]interface{} {
 		body["choices"] = opt.Choices
 	}
 	if opt.AutoComplete {
-		body["auto_complete"] = true
+		body["autocomplete"] = true
+		delete(body, "choices")
 	}
 
+	localize(body, opt.NameLocalizations, opt.DescriptionLocalizations)
+
 	return body
 }
 
 func (sub *SubCommand) build() map[string]interface{} {
 	body := map[string]interface{}{
 		"name":        sub.Name,
-		"type":        1,
+		"type":        SubcommandOption,
 		"description": sub.Description,
 	}
 
@@ -52,13 +69,15 @@ func (sub *SubCommand) build() map[string]interface{} {
 
 	body["options"] = bodies
 
+	localize(body, sub.NameLocalizations, sub.DescriptionLocalizations)
+
 	return body
 }
 
 func (subGroup *SubcommandGroup) build() map[string]interface{} {
 	body := map[string]interface{}{
 		"name":        subGroup.Name,
-		"type":        2,
+		"type":        SubcommandGroupOption,
 		"description": subGroup.Description,
 	}
 
@@ -69,6 +88,186 @@ func (subGroup *SubcommandGroup) build() map[string]interface{} {
 
 	body["options"] = bodies
 
+	localize(body, subGroup.NameLocalizations, subGroup.DescriptionLocalizations)
+
+	return body
+}
+
+func (cmd *Command) build() map[string]interface{} {
+	body := map[string]interface{}{
+		"name":          cmd.Name,
+		"description":   cmd.Description,
+		"dm_permission": cmd.DMPermission,
+		"nsfw":          cmd.NSFW,
+	}
+	body["type"] = 1
+
+	ln := len(cmd.Options) + len(cmd.Subcommands) + len(cmd.SubcommandGroups)
+	builds := make([]map[string]interface{}, ln)
+
+	var pos int
+	for idx := range cmd.Options {
+		builds[pos] = cmd.Options[idx].build()
+		pos++
+	}
+
+	for idx := range cmd.Subcommands {
+		builds[pos] = cmd.Subcommands[idx].build()
+		pos++
+	}
+
+	for idx := range cmd.SubcommandGroups {
+		builds[pos] = cmd.SubcommandGroups[idx].build()
+		pos++
+	}
+
+	body["options"] = builds
+
+	def := strconv.Itoa(1 << 11)
+	if len(cmd.Permissions) > 0 {
+		var perm int
+		for idx := range cmd.Permissions {
+			perm |= int(cmd.Permissions[idx])
+		}
+		def = strconv.Itoa(perm)
+	}
+
+	body["default_member_permissions"] = def
+
+	localize(body, cmd.NameLocalizations, cmd.DescriptionLocalizations)
+
+	return body
+}
+
+func localize(body map[string]interface{}, names map[string]string, descriptions map[string]string) {
+	if len(names) > 0 {
+		body["name_localizations"] = names
+	}
+	if len(descriptions) > 0 {
+		body["description_localizations"] = descriptions
+	}
+}
+
+func same(want interface{}, have interface{}) bool {
+	if zero(want) && zero(have) {
+		return true
+	}
+
+	switch want := want.(type) {
+	case map[string]interface{}:
+		have, ok := have.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		for key, val := range want {
+			if !same(val, have[key]) {
+				return false
+			}
+		}
+
+		for key, val := range have {
+			if _, ok := want[key]; ok || populated[key] {
+				continue
+			}
+			if !zero(val) {
+				return false
+			}
+		}
+
+		return true
+
+	case []interface{}:
+		have, ok := have.([]interface{})
+		if !ok {
+			return len(want) == 0 && have == nil
+		}
+		if len(want) != len(have) {
+			return false
+		}
+
+		for idx := range want {
+			if !same(want[idx], have[idx]) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		if zero(want) && zero(have) {
+			return true
+		}
+
+		return want == have
+	}
+}
+
+func zero(val interface{}) bool {
+	switch val := val.(type) {
+	case nil:
+		return true
+	case bool:
+		return !val
+	case float64:
+		return val == 0
+	case string:
+		return val == ""
+	case []interface{}:
+		return len(val) == 0
+	case map[string]interface{}:
+		return len(val) == 0
+	}
+
+	return false
+}
+
+func (pres *Presence) build() map[string]interface{} {
+	body := map[string]interface{}{
+		"since":  nil,
+		"status": Online,
+		"afk":    pres.AFK,
+	}
+
+	if pres.Since != 0 {
+		body["since"] = pres.Since
+	}
+	if pres.Status != "" {
+		body["status"] = pres.Status
+	}
+
+	activities := make([]map[string]interface{}, 0, len(pres.Activities)+1)
+	for _, actv := range append([]Activity{pres.Activity}, pres.Activities...) {
+		if actv.Name == "" && actv.State == "" {
+			continue
+		}
+		activities = append(activities, actv.build())
+	}
+	body["activities"] = activities
+
+	return body
+}
+
+func (pres *Presence) empty() bool {
+	return pres.Status == "" && pres.Activity == (Activity{}) && len(pres.Activities) == 0
+}
+
+func (actv *Activity) build() map[string]interface{} {
+	body := map[string]interface{}{
+		"type": actv.Type,
+		"name": actv.Name,
+	}
+
+	if actv.Type == Custom && actv.Name == "" {
+		body["name"] = "Custom Status"
+	}
+	if actv.State != "" {
+		body["state"] = actv.State
+	}
+	if actv.URL != "" {
+		body["url"] = actv.URL
+	}
+
 	return body
 }
 
@@ -155,5 +354,149 @@ func (res *Response) build() (map[string]interface{}, error) {
 	}
 	body["attachments"] = attachments
 
+	if len(res.Components) > 0 {
+		rows, err := rows(res.Components)
+		if err != nil {
+			return nil, err
+		}
+		body["components"] = rows
+	}
+
+	return body, nil
+}
+
+func (modal *Modal) build() (map[string]interface{}, error) {
+	if len([]rune(modal.Title)) > 45 {
+		return nil, errors.New("modal title is longer than 45 characters")
+	}
+
+	rows, err := rows(modal.Components)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"custom_id":  modal.CustomId,
+		"title":      modal.Title,
+		"components": rows,
+	}
+
+	return body, nil
+}
+
+func rows(rows []Row) ([]map[string]interface{}, error) {
+	if len(rows) > 5 {
+		return nil, errors.New("more than 5 component rows")
+	}
+
+	bodies := make([]map[string]interface{}, len(rows))
+	for idx := range rows {
+		if len(rows[idx].Components) > 5 {
+			return nil, errors.New("more than 5 components in a row")
+		}
+
+		comps := make([]map[string]interface{}, len(rows[idx].Components))
+		for pos := range rows[idx].Components {
+			comp, err := rows[idx].Components[pos].build()
+			if err != nil {
+				return nil, err
+			}
+			comps[pos] = comp
+		}
+
+		bodies[idx] = map[string]interface{}{
+			"type":       RowComponent,
+			"components": comps,
+		}
+	}
+
+	return bodies, nil
+}
+
+func (comp *Component) build() (map[string]interface{}, error) {
+	body := map[string]interface{}{
+		"type": comp.Type,
+	}
+
+	if len(comp.CustomId) > 100 {
+		return nil, errors.New("custom id is longer than 100 characters")
+	}
+	if comp.CustomId != "" {
+		body["custom_id"] = comp.CustomId
+	}
+
+	switch comp.Type {
+	case ButtonComponent:
+		body["style"] = comp.Style
+		if comp.Label != "" {
+			body["label"] = comp.Label
+		}
+		if comp.Emoji != "" {
+			body["emoji"] = map[string]interface{}{"name": comp.Emoji}
+		}
+		if comp.Style == LinkButton {
+			if !strings.HasPrefix(comp.URL, "http") {
+				return nil, errors.New("url didn't start with http/https")
+			}
+			body["url"] = comp.URL
+		}
+		body["disabled"] = comp.Disabled
+
+	case StringSelectComponent, UserSelectComponent, RoleSelectComponent, MentionableSelectComponent, ChannelSelectComponent:
+		if comp.Placeholder != "" {
+			body["placeholder"] = comp.Placeholder
+		}
+		if comp.MinValues > 0 {
+			body["min_values"] = comp.MinValues
+		}
+		if comp.MaxValues > 0 {
+			body["max_values"] = comp.MaxValues
+		}
+		body["disabled"] = comp.Disabled
+
+		if comp.Type == StringSelectComponent {
+			if len(comp.Options) > 25 {
+				return nil, errors.New("more than 25 select options")
+			}
+
+			opts := make([]map[string]interface{}, len(comp.Options))
+			for idx, opt := range comp.Options {
+				opts[idx] = map[string]interface{}{
+					"label":   opt.Label,
+					"value":   opt.Value,
+					"default": opt.Default,
+				}
+				if opt.Description != "" {
+					opts[idx]["description"] = opt.Description
+				}
+				if opt.Emoji != "" {
+					opts[idx]["emoji"] = map[string]interface{}{"name": opt.Emoji}
+				}
+			}
+			body["options"] = opts
+		}
+
+		if comp.Type == ChannelSelectComponent && len(comp.ChannelTypes) > 0 {
+			body["channel_types"] = comp.ChannelTypes
+		}
+
+	case TextInputComponent:
+		body["style"] = comp.Style
+		body["label"] = comp.Label
+		body["required"] = comp.Required
+		if comp.MinLength > 0 {
+			body["min_length"] = comp.MinLength
+		}
+		if comp.MaxLength > 0 {
+			body["max_length"] = comp.MaxLength
+		}
+		if comp.Value != "" {
+			body["value"] = comp.Value
+		}
+		if comp.Placeholder != "" {
+			body["placeholder"] = comp.Placeholder
+		}
+	}
+
 	return body, nil
 }
@@ -1,51 +1,117 @@
 package discord
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"zundago/etf"
 	"zundago/socket"
 )
 
 type Session struct {
-	sock      *sock
-	Cached    bool
-	Presence  Presence
-	Listeners Listeners
-	Commands  []Command
+	socks      []*sock
+	intt       int
+	rest       *rest
+	err        chan error
+	quit       chan bool
+	Host       string
+	Client     *http.Client
+	Dialer     *socket.Dialer
+	Compress   bool
+	ETF        bool
+	Cached     bool
+	Cache      Cache
+	Retries    int
+	Presence   Presence
+	Listeners  Listeners
+	Commands   []Command
+	Prune      []string
+	Components map[string]func(bot *Bot, interaction *Interaction)
 }
 
 type sock struct {
+	id      int
+	total   int
 	bot     *Bot
 	lock    bool
-	seq     int
+	seq     int64
 	intt    int
 	mem     bool
 	sent    int64
 	ack     int64
+	acked   int32
+	stop    chan struct{}
 	lat     int64
+	mutex   *sync.Mutex
+	updates []time.Time
+	nonce   int64
+	reqs    map[string]*request
 	pres    Presence
 	sec     string
 	que     []Command
+	prune   []string
 	list    Listeners
+	comps   map[string]func(bot *Bot, interaction *Interaction)
+	cmds    map[string]*Command
 	lazy    map[string]bool
 	shard   Sharding
 	runtime Runtime
+	sess    string
+	gate    string
+	query   string
+	etf     bool
+	tries   int
+	retries int
+	down    bool
+	closed  int32
+	ready   *int32
+	thr     *throttle
+	rest    *rest
+	dialer  *socket.Dialer
 	conn    *socket.Conn
 	err     chan error
 }
 
-type glob struct {
-	Guilds   map[string]*Guild
-	Channels map[string]*Channel
-	Voices   map[string]*Voice
+type throttle struct {
+	mutex  *sync.Mutex
+	left   int
+	reset  time.Time
+	total  int
+	locks  []*sync.Mutex
+	idents []time.Time
+}
+
+type memberChunk struct {
+	GuildId    string           `json:"guild_id"`
+	Members    []Member         `json:"members"`
+	ChunkIndex int              `json:"chunk_index"`
+	ChunkCount int              `json:"chunk_count"`
+	NotFound   []string         `json:"not_found"`
+	Presences  []PresenceUpdate `json:"presences"`
+	Nonce      string           `json:"nonce"`
+}
+
+type request struct {
+	members []Member
+	left    int
+	done    chan struct{}
+}
+
+type roleUpdate struct {
+	GuildId string `json:"guild_id"`
+	RoleId  string `json:"role_id"`
+	Role    Role   `json:"role"`
 }
 
 type msg struct {
@@ -59,71 +125,237 @@ type hello struct {
 	HeartbeatInterval float64 `json:"heartbeat_interval"`
 }
 
-func (sock *sock) start() error {
+func gateway(rest *rest) (*Sharding, error) {
 
-	req, err := http.NewRequest(http.MethodGet, HOST+"gateway/bot", nil)
+	sharding := new(Sharding)
+	err := rest.json(http.MethodGet, "gateway/bot", nil, sharding)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bot "+sock.sec)
+	if sharding.Shards < 1 {
+		sharding.Shards = 1
+	}
 
-	res, err := client.Do(req)
-	if err != nil {
-		return err
+	if sharding.SessionStartLimit.MaxConcurrency < 1 {
+		sharding.SessionStartLimit.MaxConcurrency = 1
 	}
 
-	defer res.Body.Close()
-	if res.StatusCode/100 != 2 {
-		err = new(Error)
-		json.NewDecoder(res.Body).Decode(err)
-		return err
+	return sharding, nil
+}
+
+func owner(guild string, total int) int {
+	id, err := strconv.ParseUint(guild, 10, 64)
+	if err != nil || total < 1 {
+		return 0
 	}
 
-	sharding := new(Sharding)
-	err = json.NewDecoder(res.Body).Decode(sharding)
-	if err != nil {
-		return err
+	return int((id >> 22) % uint64(total))
+}
+
+func (sess *Session) start(tok string) error {
+
+	sess.rest = newRest(tok)
+	if sess.Host != "" {
+		sess.rest.host = sess.Host
+	}
+	if sess.Client != nil {
+		sess.rest.client = sess.Client
 	}
 
-	sharding.URL = sharding.URL + "?v=10&encoding=json"
-	sock.shard = *sharding
+	dialer := sess.Dialer
+	if dialer == nil {
+		dialer = socket.DefaultDialer
+	}
 
-	sock.conn, err = socket.Dial(sharding.URL)
+	sharding, err := gateway(sess.rest)
 	if err != nil {
 		return err
 	}
 
-	go sock.event()
+	query := "?v=10&encoding=json"
+	if sess.ETF {
+		query = "?v=10&encoding=etf"
+	}
+	if sess.Compress {
+		query += "&compress=zlib-stream"
+
+		stream := *dialer
+		stream.Stream = true
+		dialer = &stream
+	}
+
+	sharding.URL += query
+
+	limit := sharding.SessionStartLimit
+	if limit.Remaining < sharding.Shards {
+		time.Sleep(time.Millisecond * time.Duration(limit.Reset))
+		limit.Remaining = limit.Total
+	}
+
+	thr := &throttle{
+		mutex:  new(sync.Mutex),
+		left:   limit.Remaining,
+		reset:  time.Now().Add(time.Millisecond * time.Duration(limit.Reset)),
+		total:  limit.Total,
+		locks:  make([]*sync.Mutex, limit.MaxConcurrency),
+		idents: make([]time.Time, limit.MaxConcurrency),
+	}
+	for idx := range thr.locks {
+		thr.locks[idx] = new(sync.Mutex)
+	}
+
+	retries := sess.Retries
+	if retries < 1 {
+		retries = 10
+	}
+
+	if sess.Cache != 0 {
+		Global.setFlags(sess.Cache)
+	}
+
+	sess.err = make(chan error, sharding.Shards)
+	sess.quit = make(chan bool, 1)
+	sess.socks = make([]*sock, sharding.Shards)
+
+	cmds := make(map[string]*Command, len(sess.Commands))
+	for idx := range sess.Commands {
+		cmds[sess.Commands[idx].Name] = &sess.Commands[idx]
+	}
+
+	ready := new(int32)
+	for idx := range sess.socks {
+		sock := &sock{
+			id:      idx,
+			total:   sharding.Shards,
+			intt:    sess.intt,
+			lock:    true,
+			mem:     sess.Cached,
+			mutex:   new(sync.Mutex),
+			reqs:    make(map[string]*request),
+			pres:    sess.Presence,
+			sec:     tok,
+			list:    sess.Listeners,
+			comps:   sess.Components,
+			cmds:    cmds,
+			query:   query,
+			etf:     sess.ETF,
+			shard:   *sharding,
+			retries: retries,
+			ready:   ready,
+			thr:     thr,
+			rest:    sess.rest,
+			dialer:  dialer,
+			err:     sess.err,
+		}
+
+		if idx == 0 {
+			sock.que = sess.Commands
+			sock.prune = sess.Prune
+		}
+
+		sess.socks[idx] = sock
+	}
+
+	for idx, sock := range sess.socks {
+		err := sock.start()
+		if err != nil {
+			for _, started := range sess.socks[:idx] {
+				started.end(1000)
+			}
+			return err
+		}
+	}
 
-	sock.err = make(chan error, 1)
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
 
 	select {
-	case err := <-sock.err:
+	case err := <-sess.err:
 		return err
+	case <-sess.quit:
+		return nil
 	case <-sig:
-		return sock.end(1000)
+		return sess.end(1000)
 	}
 }
 
-func (sock *sock) end(code int) error {
+func (sess *Session) end(code int) error {
+
+	for _, guild := range Global.voiceGuilds() {
+		sess.route(guild).disconnect(guild)
+	}
+
+	for _, sock := range sess.socks {
+		err := sock.end(code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	for _, voice := range Global.Voices {
-		sock.disconnect(voice.GuildId)
+func (sess *Session) route(guild string) *sock {
+	if len(sess.socks) == 0 {
+		return nil
 	}
 
-	if sock.conn != nil {
-		err := sock.conn.WriteClose(code)
+	return sess.socks[owner(guild, len(sess.socks))]
+}
+
+func (thr *throttle) wait(shard int) {
+
+	thr.mutex.Lock()
+	if thr.left <= 0 {
+		time.Sleep(time.Until(thr.reset))
+		thr.left = thr.total
+		thr.reset = time.Now().Add(time.Hour * 24)
+	}
+	thr.left--
+	thr.mutex.Unlock()
+
+	key := shard % len(thr.locks)
+
+	thr.locks[key].Lock()
+	defer thr.locks[key].Unlock()
+
+	time.Sleep(time.Until(thr.idents[key].Add(time.Second * 5)))
+	thr.idents[key] = time.Now()
+}
+
+func (sock *sock) start() error {
+
+	conn, err := sock.dialer.Dial(sock.shard.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	err = sock.swap(conn)
+	if err != nil {
+		return err
+	}
+
+	go sock.event()
+
+	return nil
+}
+
+func (sock *sock) end(code int) error {
+	atomic.StoreInt32(&sock.closed, 1)
+	sock.halt()
+
+	conn := sock.socket()
+	if conn != nil {
+		err := conn.WriteClose(code)
 		if err != nil {
 			return err
 		}
 
 		time.Sleep(time.Second)
 
-		err = sock.conn.Close()
+		err = conn.Close()
 		if err != nil {
 			return err
 		}
@@ -134,7 +366,7 @@ func (sock *sock) end(code int) error {
 
 func (sock *sock) connect(guild string, channel string, mute bool, deaf bool) (*Voice, error) {
 
-	_, ok := Global.Voices[guild]
+	_, ok := Global.Voice(guild)
 	if ok {
 		err := sock.disconnect(guild)
 		if err != nil {
@@ -142,14 +374,26 @@ func (sock *sock) connect(guild string, channel string, mute bool, deaf bool) (*
 		}
 	}
 
+	dialer := *sock.dialer
+	dialer.Stream = false
+
 	voice := &Voice{
-		ChannelId: channel,
+		channelId: channel,
 		GuildId:   guild,
+		Send:      make(chan []byte),
+		Events:    make(chan *VoiceEvent, 16),
 		mute:      mute,
 		deaf:      deaf,
+		dialer:    &dialer,
 		ready:     make(chan bool, 1),
 		server:    make(chan *VoiceServerUpdate, 1),
 		state:     make(chan *VoiceState, 1),
+		kick:      make(chan bool, 8),
+		quit:      make(chan struct{}),
+		err:       make(chan error, 1),
+		mutex:     new(sync.Mutex),
+		ssrcs:     make(map[uint32]string),
+		users:     make(map[string]chan *VoicePacket),
 	}
 
 	dat := map[string]interface{}{
@@ -159,12 +403,12 @@ func (sock *sock) connect(guild string, channel string, mute bool, deaf bool) (*
 		"self_deaf":  deaf,
 	}
 
-	err := sock.conn.WriteJSON(map[string]interface{}{"op": 4, "d": dat})
+	err := sock.send(sock.socket(), map[string]interface{}{"op": 4, "d": dat})
 	if err != nil {
 		return nil, err
 	}
 
-	Global.Voices[guild] = voice
+	Global.setVoice(voice)
 
 	state, ok := <-voice.state
 	if !ok {
@@ -176,44 +420,42 @@ func (sock *sock) connect(guild string, channel string, mute bool, deaf bool) (*
 		return nil, errors.New("voiceServerUpdate channel closed")
 	}
 
-	conn, err := socket.Dial("wss://" + update.Endpoint + "/?v=4")
-	if err != nil {
-		return nil, err
-	}
-
-	voice.conn = conn
-
-	dat = map[string]interface{}{
-		"server_id":  voice.GuildId,
-		"user_id":    state.UserID,
-		"session_id": state.SessionID,
-		"token":      update.Token,
-	}
+	voice.user = state.UserID
+	voice.session = state.SessionID
+	voice.token = update.Token
+	voice.endpoint = update.Endpoint
 
-	err = voice.conn.WriteJSON(map[string]interface{}{"op": 0, "d": dat})
+	err = voice.open(false)
 	if err != nil {
+		voice.end(err)
 		return nil, err
 	}
 
-	go voice.event()
-
 	select {
 	case <-voice.ready:
-		return voice, nil
 	case err := <-voice.err:
+		voice.end(err)
 		return nil, err
 	}
+
+	voice.mutex.Lock()
+	voice.live = true
+	voice.mutex.Unlock()
+
+	go voice.supervise()
+
+	return voice, nil
 }
 
 func (sock *sock) disconnect(guild string) error {
 
-	voice, ok := Global.Voices[guild]
+	voice, ok := Global.Voice(guild)
 
 	if !ok {
 		return errors.New("not connected to voice channels")
 	}
 
-	delete(Global.Voices, voice.GuildId)
+	Global.deleteVoice(voice.GuildId)
 
 	dat := map[string]interface{}{
 		"guild_id":   guild,
@@ -222,31 +464,12 @@ func (sock *sock) disconnect(guild string) error {
 		"self_mute":  true,
 	}
 
-	err := sock.conn.WriteJSON(map[string]interface{}{"op": 4, "d": dat})
+	err := sock.send(sock.socket(), map[string]interface{}{"op": 4, "d": dat})
 	if err != nil {
 		return err
 	}
 
-	if voice.udp != nil {
-		err := voice.udp.Close()
-		if err != nil {
-			return err
-		}
-	}
-
-	if voice.conn != nil {
-		err := voice.conn.WriteClose(1000)
-		if err != nil {
-			return err
-		}
-
-		time.Sleep(time.Second)
-
-		err = voice.conn.Close()
-		if err != nil {
-			return err
-		}
-	}
+	voice.end(nil)
 
 	return nil
 }
@@ -255,148 +478,102 @@ func (sock *sock) event() {
 	for {
 		msg := new(msg)
 
-		err := sock.conn.ReadJSON(msg)
-		if errors.Is(err, io.EOF) {
-			sock.err <- io.ErrUnexpectedEOF
-			return
-		} else if err != nil {
-			sock.err <- err
-			return
-		}
-		sock.seq = msg.S
-
-		switch msg.T {
-		case ready:
-			runtime := new(Runtime)
-
-			err := json.Unmarshal(msg.D, runtime)
-			if err != nil {
-				sock.err <- err
+		err := sock.read(msg)
+		if err != nil {
+			if atomic.LoadInt32(&sock.closed) == 1 {
 				return
 			}
-			sock.runtime = *runtime
-
-			sock.lazy = make(map[string]bool, len(runtime.Guilds))
-			for _, guild := range runtime.Guilds {
-				sock.lazy[guild.Id] = true
-			}
-
-			bodies := make([]map[string]interface{}, len(sock.que))
-			for idx, cmd := range sock.que {
-
-				body := map[string]interface{}{
-					"name":          cmd.Name,
-					"description":   cmd.Description,
-					"dm_permission": cmd.DMPermission,
-				}
-				body["type"] = 1
-
-				ln := len(cmd.Options) + len(cmd.Subcommands) + len(cmd.SubcommandGroups)
-				builds := make([]map[string]interface{}, ln)
-
-				var pos int
-				for idx := range cmd.Options {
-					builds[pos] = cmd.Options[idx].build()
-					pos++
-				}
-
-				for idx := range cmd.Subcommands {
-					builds[pos] = cmd.Subcommands[idx].build()
-					pos++
-				}
-
-				for idx := range cmd.SubcommandGroups {
-					builds[pos] = cmd.SubcommandGroups[idx].build()
-					pos++
-				}
 
-				body["options"] = builds
+			resume := true
 
-				def := strconv.Itoa(1 << 11)
-				if len(cmd.Permissions) > 0 {
-					var perm int
-					for idx := range cmd.Permissions {
-						perm |= int(cmd.Permissions[idx])
-					}
-					def = strconv.Itoa(perm)
+			var closed *socket.CloseError
+			if errors.As(err, &closed) {
+				switch closed.Code {
+				case 4004, 4010, 4011, 4012, 4013, 4014:
+					sock.err <- closed
+					return
+				case 4007, 4009:
+					resume = false
 				}
-
-				body["default_member_permissions"] = def
-
-				bodies[idx] = body
+			} else if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
 			}
 
-			route := fmt.Sprintf("applications/%s/commands", runtime.Application.Id)
-
-			buf := new(bytes.Buffer)
-
-			err = json.NewEncoder(buf).Encode(bodies)
+			err = sock.retry(err, resume)
 			if err != nil {
+				if atomic.LoadInt32(&sock.closed) == 1 {
+					return
+				}
 				sock.err <- err
 				return
 			}
+			continue
+		}
 
-			req, err := http.NewRequest(http.MethodPut, HOST+route, buf)
-			if err != nil {
-				sock.err <- err
-				return
-			}
+		if msg.S != 0 {
+			atomic.StoreInt64(&sock.seq, int64(msg.S))
+		}
 
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", "Bot "+sock.sec)
+		switch msg.T {
+		case ready:
+			runtime := new(Runtime)
 
-			res, err := client.Do(req)
+			err := sock.decode(msg.D, runtime)
 			if err != nil {
 				sock.err <- err
 				return
 			}
+			sock.runtime = *runtime
+			sock.sess = runtime.SessionId
+			sock.gate = runtime.ResumeGatewayURL
 
-			defer res.Body.Close()
-			if res.StatusCode/100 != 2 {
-				err = new(Error)
-				json.NewDecoder(res.Body).Decode(err)
-				sock.err <- err
-				return
+			sock.lazy = make(map[string]bool, len(runtime.Guilds))
+			for _, guild := range runtime.Guilds {
+				sock.lazy[guild.Id] = true
 			}
 
-			_, err = io.Copy(io.Discard, res.Body)
-			if err != nil {
-				sock.err <- err
-				return
+			if sock.id == 0 && sock.bot == nil {
+				err := sock.register(runtime.Application.Id)
+				if err != nil {
+					sock.err <- err
+					return
+				}
 			}
 
+			first := sock.bot == nil
+
 			sock.bot = &runtime.User
-			sock.bot.Latency = sock.lat
 			sock.lock = false
 
-			if sock.list.Ready != nil {
-				go sock.list.Ready(sock.bot)
+			if first && atomic.AddInt32(sock.ready, 1) == int32(sock.total) && sock.list.Ready != nil {
+				go sock.list.Ready(sock.self())
 			}
 
+			sock.restored()
+
+		case resumed:
+			sock.restored()
+
 		case guildCreate:
 			guild := new(Guild)
 
-			err := json.Unmarshal(msg.D, guild)
+			err := sock.decode(msg.D, guild)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
 			guild.ClientId = sock.bot.Id
-			Global.Guilds[guild.Id] = guild
-
-			for idx := range guild.Channels {
-				Global.Channels[guild.Channels[idx].Id] = &guild.Channels[idx]
-			}
+			Global.setGuild(guild)
 
-			if sock.mem {
+			if sock.mem && sock.intt&int(GuildMembers) != 0 {
 				dat := map[string]interface{}{
 					"guild_id": guild.Id,
 					"query":    "",
 					"limit":    0,
 				}
 
-				err := sock.conn.WriteJSON(map[string]interface{}{"op": 8, "d": dat})
+				err := sock.send(sock.socket(), map[string]interface{}{"op": 8, "d": dat})
 				if err != nil {
 					sock.err <- err
 					return
@@ -404,293 +581,904 @@ func (sock *sock) event() {
 			}
 
 			if !sock.lazy[guild.Id] && sock.list.GuildCreate != nil {
-				go sock.list.GuildCreate(sock.bot, guild)
+				go sock.list.GuildCreate(sock.self(), guild)
 			}
 
 		case guildUpdate:
 
 			guild := new(Guild)
 
-			err := json.Unmarshal(msg.D, guild)
+			err := sock.decode(msg.D, guild)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
 			guild.ClientId = sock.bot.Id
-			Global.Guilds[guild.Id] = guild
-
-			for idx := range guild.Channels {
-				Global.Channels[guild.Channels[idx].Id] = &guild.Channels[idx]
-			}
+			Global.updateGuild(guild)
 
 		case guildDelete:
 
 			guild := new(Guild)
 
-			err := json.Unmarshal(msg.D, guild)
+			err := sock.decode(msg.D, guild)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
+			if !guild.Unavailable {
+				Global.deleteGuild(guild.Id)
+			}
+
 			if sock.list.GuildDelete != nil {
-				go sock.list.GuildDelete(sock.bot, guild)
+				go sock.list.GuildDelete(sock.self(), guild)
 			}
 
 		case guildMembersChunk:
-			guild := new(Guild)
+			chunk := new(memberChunk)
 
-			err := json.Unmarshal(msg.D, guild)
+			err := sock.decode(msg.D, chunk)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-			guild = Global.Guilds[guild.Id]
-			for _, member := range guild.Members {
-				if member.User.Id == guild.ClientId {
-					guild.Me = member
-					break
-				}
-			}
-
-		case messageCreate:
-			if sock.lock {
-				break
+			for idx := range chunk.Members {
+				chunk.Members[idx].GuildId = chunk.GuildId
+				Global.setMember(&chunk.Members[idx])
 			}
 
-			if sock.list.MessageCreate != nil {
-				message := new(Message)
-
-				err := json.Unmarshal(msg.D, message)
-				if err != nil {
-					sock.err <- err
-					return
-				}
-
-				go sock.list.MessageCreate(sock.bot, message)
+			for idx := range chunk.Presences {
+				chunk.Presences[idx].GuildId = chunk.GuildId
+				Global.setPresence(&chunk.Presences[idx])
 			}
 
-		case interactionCreate:
-			if sock.lock {
-				break
+			if chunk.Nonce != "" {
+				sock.chunk(chunk)
 			}
 
-			if sock.list.InteractionCreate != nil {
-				interaction := new(Interaction)
-
-				err := json.Unmarshal(msg.D, interaction)
-				if err != nil {
-					sock.err <- err
-					return
-				}
-
-				if guild, ok := Global.Guilds[interaction.GuildId]; ok {
-					interaction.Guild = *guild
-				}
-
-				if channel, ok := Global.Channels[interaction.ChannelId]; ok {
-					interaction.Channel = *channel
-				}
+		case presenceUpdate:
+			presence := new(PresenceUpdate)
 
-				go sock.list.InteractionCreate(sock.bot, interaction)
+			err := sock.decode(msg.D, presence)
+			if err != nil {
+				sock.err <- err
+				return
 			}
 
-		case voiceServerUpdate:
-			if sock.lock {
-				break
+			Global.setPresence(presence)
+
+			if sock.list.PresenceUpdate != nil {
+				go sock.list.PresenceUpdate(sock.self(), presence)
 			}
 
-			update := new(VoiceServerUpdate)
+		case guildMemberAdd, guildMemberUpdate:
+			member := new(Member)
 
-			err := json.Unmarshal(msg.D, update)
+			err := sock.decode(msg.D, member)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-			if voice, ok := Global.Voices[update.GuildID]; ok {
-				voice.server <- update
+			Global.setMember(member)
+
+			listener := sock.list.GuildMemberAdd
+			if msg.T == guildMemberUpdate {
+				listener = sock.list.GuildMemberUpdate
 			}
 
-		case voiceStateUpdate:
-			if sock.lock {
-				break
+			if listener != nil {
+				go listener(sock.self(), member)
 			}
 
-			state := new(VoiceState)
+		case guildMemberRemove:
+			member := new(Member)
 
-			err := json.Unmarshal(msg.D, state)
+			err := sock.decode(msg.D, member)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-			if voice, ok := Global.Voices[state.GuildID]; ok {
-				if state.UserID == sock.bot.Id {
-					voice.state <- state
-				}
-			}
-
-			if guild, ok := Global.Guilds[state.GuildID]; ok {
-
-				if state.ChannelID != "" {
-					guild.VoiceStates = append(guild.VoiceStates, *state)
-				}
-
-				mp := make(map[string]bool)
-
-				if state.ChannelID == "" {
-					mp = map[string]bool{state.UserID: true}
-				}
+			Global.deleteMember(member.GuildId, member.User.Id)
 
-				nw := make([]VoiceState, 0)
-				for idx := range guild.VoiceStates {
-					state := guild.VoiceStates[len(guild.VoiceStates)-idx-1]
-					if !mp[state.UserID] {
-						mp[state.UserID] = true
-						nw = append(nw, state)
-					}
-				}
-				guild.VoiceStates = nw
-
-				if sock.list.VoiceStateUpdate != nil {
-					go sock.list.VoiceStateUpdate(sock.bot, guild.VoiceStates)
-				}
+			if sock.list.GuildMemberRemove != nil {
+				go sock.list.GuildMemberRemove(sock.self(), member)
 			}
-		}
 
-		switch msg.Op {
-		case 1:
-			err := sock.conn.WriteJSON(map[string]interface{}{"op": 1, "d": sock.seq})
+		case guildRoleCreate, guildRoleUpdate, guildRoleDelete:
+			update := new(roleUpdate)
+
+			err := sock.decode(msg.D, update)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-			sock.sent = time.Now().UnixMilli()
+			if msg.T == guildRoleDelete {
+				Global.deleteRole(update.GuildId, update.RoleId)
+				break
+			}
 
-		case 7:
+			update.Role.GuildId = update.GuildId
+			Global.setRole(&update.Role)
 
-			voices := Global.Voices
+		case channelCreate, channelUpdate, channelDelete:
+			channel := new(Channel)
 
-			err := sock.end(1012)
+			err := sock.decode(msg.D, channel)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-			sock.list.Ready = func(bot *Bot) {
-				for guild, voice := range voices {
-					voice, err := sock.connect(guild, voice.ChannelId, voice.mute, voice.deaf)
-					if err != nil {
-						continue
-					}
-					Global.Voices[guild] = voice
-				}
+			var listener func(bot *Bot, channel *Channel)
+
+			switch msg.T {
+			case channelCreate:
+				Global.setChannel(channel)
+				listener = sock.list.ChannelCreate
+			case channelUpdate:
+				Global.setChannel(channel)
+				listener = sock.list.ChannelUpdate
+			case channelDelete:
+				Global.deleteChannel(channel.Id)
+				listener = sock.list.ChannelDelete
 			}
 
-			err = sock.start()
-			if err != nil {
-				sock.err <- err
-				return
+			if listener != nil {
+				go listener(sock.self(), channel)
 			}
 
-		case 9:
-			err := sock.ident()
+		case threadCreate, threadUpdate, threadDelete:
+			thread := new(Channel)
+
+			err := sock.decode(msg.D, thread)
 			if err != nil {
 				sock.err <- err
 				return
 			}
 
-		case 10:
-			err := sock.ident()
-			if err != nil {
-				sock.err <- err
-				return
+			var listener func(bot *Bot, thread *Channel)
+
+			switch msg.T {
+			case threadCreate:
+				listener = sock.list.ThreadCreate
+			case threadUpdate:
+				listener = sock.list.ThreadUpdate
+			case threadDelete:
+				listener = sock.list.ThreadDelete
 			}
 
-			hello := new(hello)
-			err = json.Unmarshal(msg.D, hello)
-			if err != nil {
-				sock.err <- err
-				return
+			if listener != nil {
+				go listener(sock.self(), thread)
 			}
 
-			go func() {
-				for {
-					err := sock.conn.WriteJSON(map[string]interface{}{"op": 1, "d": sock.seq})
-					if err != nil {
-						sock.err <- err
-						return
-					}
+		case threadListSync:
+			if sock.list.ThreadListSync != nil {
+				threads := new(ThreadSync)
 
-					sock.sent = time.Now().UnixMilli()
-					time.Sleep(time.Millisecond * time.Duration(hello.HeartbeatInterval))
+				err := sock.decode(msg.D, threads)
+				if err != nil {
+					sock.err <- err
+					return
 				}
-			}()
+
+				go sock.list.ThreadListSync(sock.self(), threads)
+			}
+
+		case threadMember:
+			if sock.list.ThreadMemberUpdate != nil {
+				member := new(ThreadMember)
+
+				err := sock.decode(msg.D, member)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.ThreadMemberUpdate(sock.self(), member)
+			}
+
+		case threadMembers:
+			if sock.list.ThreadMembersUpdate != nil {
+				members := new(ThreadMembers)
+
+				err := sock.decode(msg.D, members)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.ThreadMembersUpdate(sock.self(), members)
+			}
+
+		case messageCreate:
+			if sock.lock {
+				break
+			}
+
+			if sock.list.MessageCreate != nil {
+				message := new(Message)
+
+				err := sock.decode(msg.D, message)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.MessageCreate(sock.self(), message)
+			}
+
+		case messageUpdate:
+			if sock.lock {
+				break
+			}
+
+			if sock.list.MessageUpdate != nil {
+				message := new(Message)
+
+				err := sock.decode(msg.D, message)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.MessageUpdate(sock.self(), message)
+			}
+
+		case messageDelete:
+			if sock.lock {
+				break
+			}
+
+			if sock.list.MessageDelete != nil {
+				message := new(MessageDelete)
+
+				err := sock.decode(msg.D, message)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.MessageDelete(sock.self(), message)
+			}
+
+		case reactionAdd:
+			if sock.lock {
+				break
+			}
+
+			if sock.list.MessageReactionAdd != nil {
+				reaction := new(Reaction)
+
+				err := sock.decode(msg.D, reaction)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.MessageReactionAdd(sock.self(), reaction)
+			}
+
+		case typingStart:
+			if sock.lock {
+				break
+			}
+
+			if sock.list.TypingStart != nil {
+				typing := new(Typing)
+
+				err := sock.decode(msg.D, typing)
+				if err != nil {
+					sock.err <- err
+					return
+				}
+
+				go sock.list.TypingStart(sock.self(), typing)
+			}
+
+		case interactionCreate:
+			if sock.lock {
+				break
+			}
+
+			interaction := new(Interaction)
+
+			err := sock.decode(msg.D, interaction)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			interaction.rest = sock.rest
+
+			if channel, ok := Global.Channel(interaction.ChannelId); ok {
+				interaction.Channel = channel
+			}
+
+			var handler func(bot *Bot, interaction *Interaction)
+
+			switch interaction.Type {
+			case ApplicationCommand:
+				if cmd, ok := sock.cmds[interaction.Data.Name]; ok {
+					handler = cmd.Handler
+				}
+			case AutoComplete:
+				if cmd, ok := sock.cmds[interaction.Data.Name]; ok {
+					handler = cmd.Autocomplete
+				}
+			case MessageComponent, ModalSubmit:
+				key := strings.SplitN(interaction.Data.CustomId, ":", 2)[0]
+				handler = sock.comps[key]
+			}
+
+			if handler == nil {
+				handler = sock.list.InteractionCreate
+			}
+
+			if handler != nil {
+				go sock.guard(handler, sock.self(), interaction)
+			}
+
+		case voiceServerUpdate:
+			if sock.lock {
+				break
+			}
+
+			update := new(VoiceServerUpdate)
+
+			err := sock.decode(msg.D, update)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			if voice, ok := Global.Voice(update.GuildID); ok {
+				voice.move(update)
+			}
+
+		case voiceStateUpdate:
+			if sock.lock {
+				break
+			}
+
+			state := new(VoiceState)
+
+			err := sock.decode(msg.D, state)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			if voice, ok := Global.Voice(state.GuildID); ok {
+				if state.UserID == sock.bot.Id {
+					voice.update(state)
+				}
+			}
+
+			Global.setVoiceState(state)
+
+			if sock.list.VoiceStateUpdate != nil {
+				go sock.list.VoiceStateUpdate(sock.self(), Global.VoiceStates(state.GuildID))
+			}
+		}
+
+		if msg.T != "" && sock.list.Raw != nil {
+			data, err := sock.raw(msg.D)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			go sock.list.Raw(sock.self(), msg.T, data)
+		}
+
+		switch msg.Op {
+		case 1:
+			err := sock.send(sock.socket(), map[string]interface{}{"op": 1, "d": atomic.LoadInt64(&sock.seq)})
+			if err != nil {
+				err = sock.retry(err, true)
+			}
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			atomic.StoreInt64(&sock.sent, time.Now().UnixMilli())
+
+		case 7:
+			err := sock.reconnect(true)
+			if err != nil {
+				err = sock.retry(err, true)
+			}
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+		case 9:
+			var ok bool
+
+			err := sock.decode(msg.D, &ok)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			if !ok {
+				time.Sleep(time.Second + time.Duration(rand.Int63n(int64(time.Second*4))))
+			}
+
+			err = sock.reconnect(ok)
+			if err != nil {
+				err = sock.retry(err, ok)
+			}
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+		case 10:
+			hello := new(hello)
+			err := sock.decode(msg.D, hello)
+			if err != nil {
+				sock.err <- err
+				return
+			}
+
+			sock.beat(time.Millisecond * time.Duration(hello.HeartbeatInterval))
+
+			if sock.sess != "" {
+				err = sock.resume()
+			} else {
+				err = sock.ident()
+			}
+			if err != nil {
+				err = sock.retry(err, true)
+			}
+			if err != nil {
+				sock.err <- err
+				return
+			}
 
 		case 11:
+			atomic.StoreInt32(&sock.acked, 1)
 			sock.ack = time.Now().UnixMilli()
-			sock.lat = sock.ack - sock.sent
-			if sock.bot != nil {
-				sock.bot.Latency = sock.lat
+			sock.lat = sock.ack - atomic.LoadInt64(&sock.sent)
+		}
+	}
+}
+
+func (sock *sock) register(app string) error {
+
+	scopes := make(map[string][]map[string]interface{})
+	for idx := range sock.que {
+		scopes[sock.que[idx].GuildId] = append(scopes[sock.que[idx].GuildId], sock.que[idx].build())
+	}
+
+	for _, guild := range sock.prune {
+		if _, ok := scopes[guild]; !ok {
+			scopes[guild] = []map[string]interface{}{}
+		}
+	}
+
+	for guild, bodies := range scopes {
+		route := fmt.Sprintf("applications/%s/commands", app)
+		if guild != "" {
+			route = fmt.Sprintf("applications/%s/guilds/%s/commands", app, guild)
+		}
+
+		var have []interface{}
+		err := sock.rest.json(http.MethodGet, route+"?with_localizations=true", nil, &have)
+		if err != nil {
+			return err
+		}
+
+		jsn, err := json.Marshal(bodies)
+		if err != nil {
+			return err
+		}
+
+		var want []interface{}
+		err = json.Unmarshal(jsn, &want)
+		if err != nil {
+			return err
+		}
+
+		if matches(want, have) {
+			continue
+		}
+
+		err = sock.rest.json(http.MethodPut, route, bodies, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func matches(want []interface{}, have []interface{}) bool {
+	if len(want) != len(have) {
+		return false
+	}
+
+	names := make(map[string]interface{}, len(have))
+	for _, cmd := range have {
+		if cmd, ok := cmd.(map[string]interface{}); ok {
+			name, _ := cmd["name"].(string)
+			names[name] = cmd
+		}
+	}
+
+	for _, cmd := range want {
+		name, _ := cmd.(map[string]interface{})["name"].(string)
+		if !same(cmd, names[name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (sock *sock) guard(handler func(bot *Bot, interaction *Interaction), bot *Bot, interaction *Interaction) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err := fmt.Errorf("panic in interaction (%s):%v", interaction.Data.Name+interaction.Data.CustomId, rec)
+			if sock.list.Error != nil {
+				sock.list.Error(bot, err)
+				return
+			}
+			log.Println(err)
+		}
+	}()
+
+	handler(bot, interaction)
+}
+
+func (sock *sock) self() *Bot {
+	if sock.bot == nil {
+		return nil
+	}
+
+	bot := *sock.bot
+	bot.Latency = sock.lat
+
+	return &bot
+}
+
+func (sock *sock) retry(cause error, resume bool) error {
+
+	if !sock.down {
+		sock.down = true
+		if sock.list.Disconnect != nil {
+			go sock.list.Disconnect(sock.self(), cause)
+		}
+	}
+
+	for sock.tries < sock.retries {
+		wait := time.Second << sock.tries
+		if wait > time.Minute || wait <= 0 {
+			wait = time.Minute
+		}
+		time.Sleep(wait/2 + time.Duration(rand.Int63n(int64(wait/2))))
+
+		if atomic.LoadInt32(&sock.closed) == 1 {
+			return cause
+		}
+
+		err := sock.reconnect(resume)
+		if err == nil {
+			return nil
+		}
+		cause = err
+	}
+
+	return cause
+}
+
+func (sock *sock) restored() {
+	sock.tries = 0
+
+	if sock.down {
+		sock.down = false
+		if sock.list.Reconnect != nil {
+			go sock.list.Reconnect(sock.self())
+		}
+	}
+}
+
+func (sock *sock) beat(interval time.Duration) {
+	sock.halt()
+
+	stop := make(chan struct{})
+
+	sock.mutex.Lock()
+	sock.stop = stop
+	sock.mutex.Unlock()
+
+	conn := sock.socket()
+	atomic.StoreInt32(&sock.acked, 1)
+
+	go func() {
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(interval))))
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			if atomic.SwapInt32(&sock.acked, 0) == 0 {
+				conn.WriteClose(4000)
+				conn.Close()
+				return
+			}
+
+			err := sock.send(conn, map[string]interface{}{"op": 1, "d": atomic.LoadInt64(&sock.seq)})
+			if err != nil {
+				conn.Close()
+				return
 			}
+
+			atomic.StoreInt64(&sock.sent, time.Now().UnixMilli())
+			timer.Reset(interval)
 		}
+	}()
+}
+
+func (sock *sock) halt() {
+	sock.mutex.Lock()
+	stop := sock.stop
+	sock.stop = nil
+	sock.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+}
+
+func (sock *sock) reconnect(resume bool) error {
+	sock.tries++
+	sock.halt()
+
+	if conn := sock.socket(); conn != nil {
+		conn.WriteClose(4000)
+		conn.Close()
+	}
+
+	url := sock.shard.URL
+	if resume && sock.sess != "" && sock.gate != "" {
+		url = sock.gate + "/" + sock.query
+	} else {
+		sock.sess = ""
+		atomic.StoreInt64(&sock.seq, 0)
+	}
+
+	conn, err := sock.dialer.Dial(url, nil)
+	if err != nil {
+		return err
 	}
+
+	return sock.swap(conn)
+}
+
+func (sock *sock) socket() *socket.Conn {
+	sock.mutex.Lock()
+	defer sock.mutex.Unlock()
+
+	return sock.conn
+}
+
+func (sock *sock) swap(conn *socket.Conn) error {
+	sock.mutex.Lock()
+	defer sock.mutex.Unlock()
+
+	if atomic.LoadInt32(&sock.closed) == 1 {
+		conn.Close()
+		return errors.New("socket closed")
+	}
+
+	sock.conn = conn
+
+	return nil
+}
+
+func (sock *sock) resume() error {
+	dat := map[string]interface{}{
+		"token":      sock.sec,
+		"session_id": sock.sess,
+		"seq":        atomic.LoadInt64(&sock.seq),
+	}
+
+	err := sock.send(sock.socket(), map[string]interface{}{"op": 6, "d": dat})
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func (sock *sock) ident() error {
+	sock.thr.wait(sock.id)
+
 	ident := map[string]interface{}{
 		"token":   sock.sec,
 		"intents": sock.intt,
+		"shard":   []int{sock.id, sock.total},
 	}
 	props := map[string]string{
 		"os":      "linux",
 		"browser": "discord",
 		"device":  "discord",
 	}
-	if sock.pres.Activity.Name != "" {
-		pres := make(map[string]interface{})
-		if sock.pres.Since != 0 {
-			pres["since"] = sock.pres.Since
-		}
 
-		if sock.pres.Status != "" {
-			pres["status"] = sock.pres.Status
-		}
+	sock.mutex.Lock()
+	pres := sock.pres
+	sock.mutex.Unlock()
 
-		if sock.pres.AFK {
-			pres["afk"] = true
-		}
+	if !pres.empty() {
+		ident["presence"] = pres.build()
+	}
 
-		actv := make(map[string]interface{})
+	if pres.OnMobile {
+		props["browser"] = "Discord iOS"
+	}
 
-		actv["type"] = sock.pres.Activity.Type
+	ident["properties"] = props
 
-		if sock.pres.Activity.Name != "" {
-			actv["name"] = sock.pres.Activity.Name
-		}
+	err := sock.send(sock.socket(), map[string]interface{}{"op": 2, "d": ident})
+	if err != nil {
+		return err
+	}
 
-		if sock.pres.Activity.URL != "" {
-			actv["url"] = sock.pres.Activity.URL
-		}
+	return nil
+}
 
-		pres["activities"] = []map[string]interface{}{actv}
-		ident["presence"] = pres
+func (sock *sock) members(guild string, query string, users []string) ([]Member, error) {
+	if len(users) > 100 {
+		return nil, errors.New("cannot request more than 100 users")
 	}
 
-	if sock.pres.OnMobile {
-		props["browser"] = "Discord iOS"
+	nonce := strconv.FormatInt(atomic.AddInt64(&sock.nonce, 1), 36)
+	req := &request{left: -1, done: make(chan struct{})}
+
+	sock.mutex.Lock()
+	sock.reqs[nonce] = req
+	sock.mutex.Unlock()
+
+	defer func() {
+		sock.mutex.Lock()
+		delete(sock.reqs, nonce)
+		sock.mutex.Unlock()
+	}()
+
+	dat := map[string]interface{}{
+		"guild_id":  guild,
+		"limit":     0,
+		"nonce":     nonce,
+		"presences": sock.intt&int(GuildPresences) != 0,
 	}
 
-	ident["properties"] = props
+	if len(users) > 0 {
+		dat["user_ids"] = users
+	} else {
+		dat["query"] = query
+	}
+
+	err := sock.send(sock.socket(), map[string]interface{}{"op": 8, "d": dat})
+	if err != nil {
+		return nil, err
+	}
 
-	err := sock.conn.WriteJSON(map[string]interface{}{"op": 2, "d": ident})
+	select {
+	case <-req.done:
+		return req.members, nil
+	case <-time.After(time.Second * 30):
+		return nil, errors.New("member request timed out")
+	}
+}
+
+func (sock *sock) chunk(chunk *memberChunk) {
+	sock.mutex.Lock()
+	defer sock.mutex.Unlock()
+
+	req, ok := sock.reqs[chunk.Nonce]
+	if !ok {
+		return
+	}
+
+	if req.left < 0 {
+		req.left = chunk.ChunkCount
+	}
+
+	req.members = append(req.members, chunk.Members...)
+	req.left--
+
+	if req.left <= 0 {
+		delete(sock.reqs, chunk.Nonce)
+		close(req.done)
+	}
+}
+
+func (sock *sock) presence(pres Presence) error {
+	sock.mutex.Lock()
+
+	now := time.Now()
+	for len(sock.updates) > 0 && now.Sub(sock.updates[0]) >= window {
+		sock.updates = sock.updates[1:]
+	}
+
+	if len(sock.updates) >= updates {
+		wait := window - now.Sub(sock.updates[0])
+		sock.mutex.Unlock()
+		return &RateLimit{Message: "presence update rate limited", RetryAfter: wait.Seconds()}
+	}
+
+	sock.updates = append(sock.updates, now)
+	sock.pres = pres
+	sock.mutex.Unlock()
+
+	conn := sock.socket()
+	if conn == nil {
+		return nil
+	}
+
+	return sock.send(conn, map[string]interface{}{"op": 3, "d": pres.build()})
+}
+
+func (sock *sock) read(msg *msg) error {
+	conn := sock.socket()
+
+	if !sock.etf {
+		return conn.ReadJSON(msg)
+	}
+
+	_, data, err := conn.ReadMessage()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return etf.Unmarshal(data, msg)
+}
+
+func (sock *sock) send(conn *socket.Conn, val interface{}) error {
+	if !sock.etf {
+		return conn.WriteJSON(val)
+	}
+
+	data, err := etf.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteMessage(socket.Binary, data)
+}
+
+func (sock *sock) decode(data json.RawMessage, val interface{}) error {
+	if sock.etf {
+		return etf.Unmarshal(data, val)
+	}
+
+	return json.Unmarshal(data, val)
+}
+
+func (sock *sock) raw(data json.RawMessage) (json.RawMessage, error) {
+	if !sock.etf {
+		return data, nil
+	}
+
+	var val interface{}
+
+	err := etf.Unmarshal(data, &val)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(val)
 }
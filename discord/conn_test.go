@@ -0,0 +1,69 @@
+package discord
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"zundago/socket"
+)
+
+func TestSwapClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		conn, err := socket.Upgrade(res, req, nil)
+		if err != nil {
+			return
+		}
+		conn.ReadMessage()
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	conn, err := socket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := &sock{mutex: new(sync.Mutex)}
+	sock.end(1000)
+
+	if err := sock.swap(conn); err == nil {
+		t.Fatal("swapped a connection into a closed socket")
+	}
+	if sock.socket() != nil {
+		t.Error("closed socket kept the new connection")
+	}
+	if err := conn.WriteMessage(socket.Text, []byte("zundamon")); err == nil {
+		t.Error("new connection was not closed")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	thr := &throttle{
+		mutex:  new(sync.Mutex),
+		left:   10,
+		total:  10,
+		locks:  []*sync.Mutex{new(sync.Mutex), new(sync.Mutex)},
+		idents: make([]time.Time, 2),
+	}
+
+	now := time.Now()
+	thr.wait(0)
+	thr.wait(1)
+	if elapsed := time.Since(now); elapsed > time.Second {
+		t.Fatalf("shards in separate buckets waited %v", elapsed)
+	}
+
+	thr.idents[0] = time.Now().Add(-time.Second*5 + time.Millisecond*200)
+
+	now = time.Now()
+	thr.wait(2)
+	if elapsed := time.Since(now); elapsed < time.Millisecond*100 || elapsed > time.Second {
+		t.Fatalf("shard sharing a bucket waited %v", elapsed)
+	}
+	if thr.left != 7 {
+		t.Errorf("got %d identifies left want 7", thr.left)
+	}
+}
@@ -0,0 +1,173 @@
+package discord
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	aes256gcm = "aead_aes256_gcm_rtpsize"
+	xchacha20 = "aead_xchacha20_poly1305_rtpsize"
+	xsalsa20  = "xsalsa20_poly1305"
+)
+
+var (
+	modes = []string{aes256gcm, xchacha20, xsalsa20}
+)
+
+type crypt struct {
+	mode  string
+	key   [32]byte
+	aead  cipher.AEAD
+	nonce uint32
+}
+
+func selectMode(offered []string) (string, error) {
+	if len(offered) == 0 {
+		return xsalsa20, nil
+	}
+
+	for _, mode := range modes {
+		for _, offer := range offered {
+			if offer == mode {
+				return mode, nil
+			}
+		}
+	}
+
+	return "", errors.New("no supported encryption mode")
+}
+
+func newCrypt(mode string, key [32]byte) (*crypt, error) {
+	crypt := &crypt{mode: mode, key: key}
+
+	var err error
+	switch mode {
+	case aes256gcm:
+		var block cipher.Block
+		block, err = aes.NewCipher(key[:])
+		if err == nil {
+			crypt.aead, err = cipher.NewGCM(block)
+		}
+	case xchacha20:
+		crypt.aead, err = chacha20poly1305.NewX(key[:])
+	case xsalsa20:
+	default:
+		err = errors.New("unsupported encryption mode: " + mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return crypt, nil
+}
+
+func (crypt *crypt) seal(head []byte, opus []byte) []byte {
+	if crypt.aead == nil {
+		var nonce [24]byte
+		copy(nonce[:], head)
+
+		return secretbox.Seal(head, opus, &nonce, &crypt.key)
+	}
+
+	nonce := make([]byte, crypt.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, crypt.nonce)
+	crypt.nonce++
+
+	pkt := make([]byte, len(head), len(head)+len(opus)+crypt.aead.Overhead()+4)
+	copy(pkt, head)
+	pkt = crypt.aead.Seal(pkt, nonce, opus, head)
+
+	return append(pkt, nonce[:4]...)
+}
+
+func (crypt *crypt) open(pkt []byte) ([]byte, bool) {
+	if len(pkt) < 12 {
+		return nil, false
+	}
+
+	if crypt.aead == nil {
+		if len(pkt) < 12+secretbox.Overhead {
+			return nil, false
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], pkt[:12])
+
+		data, ok := secretbox.Open(nil, pkt[12:], &nonce, &crypt.key)
+		if !ok {
+			return nil, false
+		}
+
+		return payload(pkt[0], data)
+	}
+
+	size := 12 + int(pkt[0]&0x0f)*4
+	if pkt[0]&0x10 != 0 {
+		size += 4
+	}
+	if len(pkt) < size+crypt.aead.Overhead()+4 {
+		return nil, false
+	}
+
+	nonce := make([]byte, crypt.aead.NonceSize())
+	copy(nonce, pkt[len(pkt)-4:])
+
+	data, err := crypt.aead.Open(nil, nonce, pkt[size:len(pkt)-4], pkt[:size])
+	if err != nil {
+		return nil, false
+	}
+
+	if pkt[0]&0x10 != 0 {
+		skip := int(binary.BigEndian.Uint16(pkt[size-2:size])) * 4
+		if len(data) < skip {
+			return nil, false
+		}
+		data = data[skip:]
+	}
+
+	if pkt[0]&0x20 != 0 && len(data) > 0 {
+		pad := int(data[len(data)-1])
+		if pad > len(data) {
+			return nil, false
+		}
+		data = data[:len(data)-pad]
+	}
+
+	return data, true
+}
+
+func payload(head byte, data []byte) ([]byte, bool) {
+	skip := int(head&0x0f) * 4
+	if len(data) < skip {
+		return nil, false
+	}
+	data = data[skip:]
+
+	if head&0x10 != 0 {
+		if len(data) < 4 {
+			return nil, false
+		}
+
+		skip = 4 + int(binary.BigEndian.Uint16(data[2:4]))*4
+		if len(data) < skip {
+			return nil, false
+		}
+		data = data[skip:]
+	}
+
+	if head&0x20 != 0 && len(data) > 0 {
+		pad := int(data[len(data)-1])
+		if pad > len(data) {
+			return nil, false
+		}
+		data = data[:len(data)-pad]
+	}
+
+	return data, true
+}
@@ -0,0 +1,110 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCryptKnownAnswer(t *testing.T) {
+	var key [32]byte
+	for idx := range key {
+		key[idx] = byte(idx)
+	}
+
+	head, _ := hex.DecodeString("80780001000003e800000457")
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{aes256gcm, "80780001000003e8000004573e43a3ce6d379bc6dc41375479ab0b3ca95eddcd15a01bb900000001"},
+		{xchacha20, "80780001000003e80000045773d23f440e6dfeb10d7d9242cb6b13389332ca4636e3225d00000001"},
+	}
+
+	for _, test := range tests {
+		crypt, err := newCrypt(test.mode, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crypt.nonce = 1
+
+		buf := make([]byte, len(head), 64)
+		copy(buf, head)
+
+		pkt := crypt.seal(buf, []byte("zundamon"))
+		if hex.EncodeToString(pkt) != test.want {
+			t.Errorf("%s: got %x want %s", test.mode, pkt, test.want)
+		}
+		if !bytes.Equal(buf, head) {
+			t.Errorf("%s: header modified: %x", test.mode, buf)
+		}
+
+		data, ok := crypt.open(pkt)
+		if !ok || string(data) != "zundamon" {
+			t.Errorf("%s: open got %q %v", test.mode, data, ok)
+		}
+
+		pkt[len(head)] ^= 1
+		if _, ok := crypt.open(pkt); ok {
+			t.Errorf("%s: open accepted tampered packet", test.mode)
+		}
+	}
+}
+
+func TestCryptSecretbox(t *testing.T) {
+	var key [32]byte
+	crypt, err := newCrypt(xsalsa20, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, _ := hex.DecodeString("80780001000003e800000457")
+	pkt := crypt.seal(append([]byte(nil), head...), []byte("zundamon"))
+
+	data, ok := crypt.open(pkt)
+	if !ok || string(data) != "zundamon" {
+		t.Errorf("got %q %v", data, ok)
+	}
+}
+
+func TestCryptExtension(t *testing.T) {
+	var key [32]byte
+	crypt, err := newCrypt(aes256gcm, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, _ := hex.DecodeString("90780001000003e800000457bede0001")
+	ext, _ := hex.DecodeString("10ff0000")
+
+	pkt := crypt.seal(append([]byte(nil), head...), append(ext, "zundamon"...))
+
+	data, ok := crypt.open(pkt)
+	if !ok || string(data) != "zundamon" {
+		t.Errorf("got %q %v", data, ok)
+	}
+}
+
+func TestSelectMode(t *testing.T) {
+	tests := []struct {
+		offered []string
+		want    string
+	}{
+		{nil, xsalsa20},
+		{[]string{xsalsa20, xchacha20}, xchacha20},
+		{[]string{xsalsa20, aes256gcm, xchacha20}, aes256gcm},
+		{[]string{"xsalsa20_poly1305_lite"}, ""},
+	}
+
+	for _, test := range tests {
+		mode, err := selectMode(test.offered)
+		if mode != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("%v: got %q %v want %q", test.offered, mode, err, test.want)
+		}
+	}
+
+	if _, err := newCrypt("xsalsa20_poly1305_lite", [32]byte{}); err == nil || err.Error() != "unsupported encryption mode: xsalsa20_poly1305_lite" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,446 @@
+package discordtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+	"zundago/discord"
+	"zundago/discord/discordtest"
+)
+
+const (
+	wait = time.Second * 5
+)
+
+func start(t *testing.T, srv *discordtest.Server, cmds []discord.Command, comps map[string]func(bot *discord.Bot, interaction *discord.Interaction)) *discord.Session {
+	ready := make(chan *discord.Bot, 1)
+
+	sess := &discord.Session{
+		Host:       srv.URL,
+		Client:     http.DefaultClient,
+		Retries:    1,
+		Commands:   cmds,
+		Components: comps,
+		Listeners: discord.Listeners{
+			Ready: func(bot *discord.Bot) {
+				ready <- bot
+			},
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Start("token")
+	}()
+
+	select {
+	case bot := <-ready:
+		if bot.Id != srv.User.Id {
+			t.Fatalf("got bot %s want %s", bot.Id, srv.User.Id)
+		}
+	case <-time.After(wait):
+		t.Fatal("timed out waiting for ready")
+	}
+
+	t.Cleanup(func() {
+		if err := sess.Close(); err != nil {
+			t.Error(err)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(wait):
+			t.Error("timed out waiting for session to end")
+		}
+	})
+
+	return sess
+}
+
+func TestGateway(t *testing.T) {
+	srv := discordtest.New()
+	t.Cleanup(srv.Close)
+
+	srv.AddGuild(discord.Guild{Id: "200000000000000001", Name: "zunda"})
+
+	cmds := []discord.Command{
+		{Name: "ping", Description: "pong", Handler: func(bot *discord.Bot, interaction *discord.Interaction) {}},
+	}
+
+	start(t, srv, cmds, nil)
+
+	req, err := srv.WaitRequest(http.MethodGet, "gateway/bot", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "Bot token" {
+		t.Errorf("got authorization %q", req.Header.Get("Authorization"))
+	}
+
+	ident, err := srv.WaitGateway(2, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identify struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(ident.D, &identify); err != nil {
+		t.Fatal(err)
+	}
+	if identify.Token != "token" {
+		t.Errorf("got identify token %q", identify.Token)
+	}
+
+	req, err = srv.WaitRequest(http.MethodPut, "applications/*/commands", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Path != "applications/"+srv.Application+"/commands" {
+		t.Errorf("got path %s", req.Path)
+	}
+
+	var bodies []map[string]interface{}
+	if err := json.Unmarshal(req.Body, &bodies); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || bodies[0]["name"] != "ping" {
+		t.Errorf("got commands %s", req.Body)
+	}
+
+	if _, ok := discord.Global.Guild("200000000000000001"); !ok {
+		t.Error("guild not cached")
+	}
+
+	srv.Disconnect(4000)
+
+	res, err := srv.WaitGateway(6, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resume struct {
+		Token   string `json:"token"`
+		Session string `json:"session_id"`
+		Seq     int    `json:"seq"`
+	}
+	if err := json.Unmarshal(res.D, &resume); err != nil {
+		t.Fatal(err)
+	}
+	if resume.Token != "token" || resume.Session != "session" || resume.Seq == 0 {
+		t.Errorf("got resume %s", res.D)
+	}
+
+	idents := 0
+	for _, payload := range srv.Payloads() {
+		if !payload.Voice && payload.Op == 2 {
+			idents++
+		}
+	}
+	if idents != 1 {
+		t.Errorf("got %d identifies want 1", idents)
+	}
+}
+
+func TestGuildCommands(t *testing.T) {
+	srv := discordtest.New()
+	t.Cleanup(srv.Close)
+
+	cmds := []discord.Command{
+		{Name: "ping", Description: "pong", GuildId: "200000000000000002"},
+	}
+
+	start(t, srv, cmds, nil)
+
+	_, err := srv.WaitRequest(http.MethodPut, "applications/*/guilds/200000000000000002/commands", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range srv.Requests() {
+		if req.Path == "applications/"+srv.Application+"/commands" {
+			t.Errorf("unexpected global command request %s %s", req.Method, req.Path)
+		}
+	}
+}
+
+func TestVoice(t *testing.T) {
+	modes := []string{"aead_aes256_gcm_rtpsize", "aead_xchacha20_poly1305_rtpsize", "xsalsa20_poly1305"}
+
+	for idx, mode := range modes {
+		t.Run(mode, func(t *testing.T) {
+			srv := discordtest.New()
+			t.Cleanup(srv.Close)
+
+			srv.Modes = []string{mode}
+
+			sess := start(t, srv, nil, nil)
+
+			guild := "20000000000000001" + strconv.Itoa(idx)
+
+			voice, err := sess.Connect(guild, "300000000000000001", false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if voice.ChannelId() != "300000000000000001" {
+				t.Errorf("got channel %s", voice.ChannelId())
+			}
+
+			sel, err := srv.WaitVoice(1, wait)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(sel.D, []byte(mode)) {
+				t.Errorf("got select protocol %s", sel.D)
+			}
+
+			pkts := voice.Receive("400000000000000001")
+
+			frames := [][]byte{{0xf8, 0xff, 0xfe}, {0xfc, 0x01, 0x02, 0x03}}
+
+			err = srv.Speak("400000000000000001", 42, frames...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for seq, frame := range frames {
+				select {
+				case pkt := <-pkts:
+					if pkt.UserId != "400000000000000001" || pkt.SSRC != 42 || pkt.Sequence != uint16(seq) || !bytes.Equal(pkt.Opus, frame) {
+						t.Errorf("got packet %+v want %v", pkt, frame)
+					}
+				case <-time.After(wait):
+					t.Fatal("timed out waiting for voice packet")
+				}
+			}
+
+			err = voice.Speak(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case voice.Send <- []byte{0xf8, 0xff, 0xfe}:
+			case <-time.After(wait):
+				t.Fatal("timed out sending voice packet")
+			}
+
+			select {
+			case frame := <-srv.Frames():
+				if !bytes.Equal(frame, []byte{0xf8, 0xff, 0xfe}) {
+					t.Errorf("got frame %v", frame)
+				}
+			case <-time.After(wait):
+				t.Fatal("timed out waiting for sent frame")
+			}
+
+			srv.DisconnectVoice(4004)
+
+			select {
+			case <-voice.Done():
+			case <-time.After(wait):
+				t.Fatal("timed out waiting for voice to close")
+			}
+		})
+	}
+}
+
+func TestCommandDiff(t *testing.T) {
+	cmds := []discord.Command{{
+		Name:        "speaker",
+		Description: "change speaker",
+		Options:     []discord.Option{{Name: "name", Type: discord.StringOption, Description: "speaker name"}},
+	}}
+
+	registered := func(autocomplete bool) discordtest.Handler {
+		opt := map[string]interface{}{"name": "name", "type": 3, "description": "speaker name", "name_localizations": nil}
+		if autocomplete {
+			opt["autocomplete"] = true
+		}
+
+		return func(req *discordtest.Request) (int, interface{}) {
+			return http.StatusOK, []map[string]interface{}{{
+				"id":                         "500000000000000001",
+				"application_id":             "100000000000000002",
+				"version":                    "500000000000000002",
+				"type":                       1,
+				"name":                       "speaker",
+				"description":                "change speaker",
+				"default_member_permissions": "2048",
+				"dm_permission":              false,
+				"nsfw":                       false,
+				"contexts":                   nil,
+				"options":                    []interface{}{opt},
+			}}
+		}
+	}
+
+	for _, autocomplete := range []bool{false, true} {
+		t.Run("autocomplete="+strconv.FormatBool(autocomplete), func(t *testing.T) {
+			srv := discordtest.New()
+			t.Cleanup(srv.Close)
+			srv.Handle(http.MethodGet, "applications/*/commands", registered(autocomplete))
+
+			start(t, srv, cmds, nil)
+
+			_, err := srv.WaitRequest(http.MethodPut, "applications/*/commands", time.Millisecond*200)
+			if autocomplete && err != nil {
+				t.Error("stale autocomplete option was not overwritten")
+			}
+			if !autocomplete && err == nil {
+				t.Error("unchanged commands were overwritten")
+			}
+		})
+	}
+}
+
+func TestPresence(t *testing.T) {
+	srv := discordtest.New()
+	t.Cleanup(srv.Close)
+
+	sess := start(t, srv, nil, nil)
+
+	pres := discord.Presence{Status: "idle", Activities: []discord.Activity{{Type: discord.Custom, State: "zundamon"}}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.SetPresence(pres)
+	}()
+	sess.CurrentPresence()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	upd, err := srv.WaitGateway(3, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(upd.D, []byte("zundamon")) {
+		t.Errorf("got presence %s", upd.D)
+	}
+
+	if got := sess.CurrentPresence(); got.Status != "idle" || len(got.Activities) != 1 {
+		t.Errorf("got current presence %+v", got)
+	}
+}
+
+func TestInteraction(t *testing.T) {
+	srv := discordtest.New()
+	t.Cleanup(srv.Close)
+
+	if _, ok := discord.Global.Guild("200000000000000001"); ok {
+		t.Fatal("guild leaked from an earlier session")
+	}
+
+	srv.AddGuild(discord.Guild{Id: "200000000000000001", Name: "edamame"})
+
+	cmds := []discord.Command{
+		{Name: "ping", Description: "pong", Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+			resp := &discord.Response{
+				Content: ":timer: レイテンシ",
+				Embeds:  []discord.Embed{{Description: strconv.FormatInt(bot.Latency, 10) + "ms"}},
+			}
+			interaction.Reply(resp)
+		}},
+		{Name: "dict", Description: "dictionary", Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+			err := interaction.Defer(false)
+			if err != nil {
+				return
+			}
+
+			guild, ok := interaction.Guild()
+			if !ok {
+				interaction.Edit(&discord.Response{Content: ":red_circle: 失敗..."})
+				return
+			}
+
+			resp := &discord.Response{
+				Content: ":book: " + guild.Name,
+				Components: []discord.Row{{Components: []discord.Component{{
+					Type:     discord.StringSelectComponent,
+					CustomId: "dict:select",
+					Options:  []discord.SelectOption{{Label: "zunda → ずんだ", Value: "zunda"}},
+				}}}},
+			}
+			interaction.Edit(resp)
+		}},
+	}
+
+	comps := map[string]func(bot *discord.Bot, interaction *discord.Interaction){
+		"dict": func(bot *discord.Bot, interaction *discord.Interaction) {
+			if len(interaction.Data.Values) == 0 {
+				return
+			}
+
+			interaction.Edit(&discord.Response{Content: ":green_circle: " + interaction.Data.Values[0]})
+		},
+	}
+
+	start(t, srv, cmds, comps)
+
+	interaction := func(id string, typ int, data map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":             id,
+			"application_id": srv.Application,
+			"type":           typ,
+			"token":          "token-" + id,
+			"guild_id":       "200000000000000001",
+			"channel_id":     "300000000000000001",
+			"member":         map[string]interface{}{"user": map[string]interface{}{"id": "400000000000000001"}},
+			"data":           data,
+		}
+	}
+
+	flows := []struct {
+		name  string
+		event map[string]interface{}
+		reqs  [][2]string
+		want  []string
+	}{
+		{"reply", interaction("700000000000000001", 2, map[string]interface{}{"name": "ping"}),
+			[][2]string{{http.MethodPost, "interactions/700000000000000001/token-700000000000000001/callback"}},
+			[]string{`"type":4`}},
+		{"defer", interaction("700000000000000002", 2, map[string]interface{}{"name": "dict"}),
+			[][2]string{
+				{http.MethodPost, "interactions/700000000000000002/token-700000000000000002/callback"},
+				{http.MethodPatch, "webhooks/*/token-700000000000000002/messages/@original"},
+			},
+			[]string{`"type":5`, `dict:select`}},
+		{"component", interaction("700000000000000003", 3, map[string]interface{}{"custom_id": "dict:select", "component_type": 3, "values": []string{"zunda"}}),
+			[][2]string{{http.MethodPost, "interactions/700000000000000003/token-700000000000000003/callback"}},
+			[]string{`"type":7`}},
+	}
+
+	for _, flow := range flows {
+		err := srv.Dispatch("INTERACTION_CREATE", flow.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx, route := range flow.reqs {
+			req, err := srv.WaitRequest(route[0], route[1], wait)
+			if err != nil {
+				t.Fatalf("%s: %v", flow.name, err)
+			}
+			if !bytes.Contains(bytes.Join(bytes.Fields(req.Body), nil), []byte(flow.want[idx])) {
+				t.Errorf("%s: got %s %s body %s", flow.name, req.Method, req.Path, req.Body)
+			}
+		}
+	}
+
+	req, err := srv.WaitRequest(http.MethodPatch, "webhooks/*/token-700000000000000002/messages/@original", wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(req.Body, []byte(":book: edamame")) {
+		t.Errorf("interaction guild not resolved: %s", req.Body)
+	}
+}
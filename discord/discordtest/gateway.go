@@ -0,0 +1,273 @@
+package discordtest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"zundago/discord"
+	"zundago/etf"
+	"zundago/socket"
+)
+
+type conn struct {
+	*socket.Conn
+	mutex *sync.Mutex
+	zlib  *zlib.Writer
+	buf   *bytes.Buffer
+	etf   bool
+}
+
+func upgrade(res http.ResponseWriter, req *http.Request) (*conn, error) {
+	sock, err := socket.Upgrade(res, req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &conn{Conn: sock, mutex: new(sync.Mutex)}
+
+	conn.etf = req.URL.Query().Get("encoding") == "etf"
+
+	if req.URL.Query().Get("compress") == "zlib-stream" {
+		conn.buf = new(bytes.Buffer)
+		conn.zlib = zlib.NewWriter(conn.buf)
+	}
+
+	return conn, nil
+}
+
+func (conn *conn) send(val interface{}) error {
+	op := socket.Text
+	data, err := json.Marshal(val)
+	if conn.etf {
+		op = socket.Binary
+		data, err = etf.Marshal(val)
+	}
+	if err != nil {
+		return err
+	}
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.zlib == nil {
+		return conn.WriteMessage(op, data)
+	}
+
+	_, err = conn.zlib.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = conn.zlib.Flush()
+	if err != nil {
+		return err
+	}
+
+	defer conn.buf.Reset()
+
+	return conn.WriteMessage(socket.Binary, conn.buf.Bytes())
+}
+
+func (conn *conn) next() (*Payload, error) {
+	op, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if op == socket.Binary {
+		var val interface{}
+
+		err := etf.Unmarshal(data, &val)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payload := new(Payload)
+
+	err = json.Unmarshal(data, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (srv *Server) Dispatch(event string, data interface{}) error {
+	srv.mutex.Lock()
+	conns := make([]*conn, 0, len(srv.conns))
+	for conn := range srv.conns {
+		conns = append(conns, conn)
+	}
+	srv.mutex.Unlock()
+
+	if len(conns) == 0 {
+		return errors.New("no gateway connections")
+	}
+
+	for _, conn := range conns {
+		err := srv.dispatch(conn, event, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (srv *Server) Disconnect(code int) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	for conn := range srv.conns {
+		conn.WriteClose(code)
+		conn.Close()
+	}
+}
+
+func (srv *Server) dispatch(conn *conn, event string, data interface{}) error {
+	srv.mutex.Lock()
+	srv.seq++
+	seq := srv.seq
+	srv.mutex.Unlock()
+
+	return conn.send(map[string]interface{}{"op": 0, "t": event, "s": seq, "d": data})
+}
+
+func (srv *Server) record(payload *Payload) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.payloads = append(srv.payloads, *payload)
+	srv.notify()
+}
+
+func (srv *Server) gateway(res http.ResponseWriter, req *http.Request) {
+	conn, err := upgrade(res, req)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	srv.mutex.Lock()
+	srv.conns[conn] = true
+	srv.mutex.Unlock()
+
+	defer func() {
+		srv.mutex.Lock()
+		delete(srv.conns, conn)
+		srv.mutex.Unlock()
+	}()
+
+	err = conn.send(map[string]interface{}{"op": 10, "d": map[string]interface{}{"heartbeat_interval": 41250}})
+	if err != nil {
+		return
+	}
+
+	for {
+		payload, err := conn.next()
+		if err != nil {
+			return
+		}
+
+		srv.record(payload)
+
+		switch payload.Op {
+		case 1:
+			err = conn.send(map[string]interface{}{"op": 11})
+		case 2:
+			err = srv.ready(conn)
+		case 4:
+			err = srv.voiceState(conn, payload.D)
+		case 6:
+			err = srv.dispatch(conn, "RESUMED", map[string]interface{}{})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (srv *Server) ready(conn *conn) error {
+	srv.mutex.Lock()
+	guilds := append([]discord.Guild(nil), srv.guilds...)
+	srv.mutex.Unlock()
+
+	unavailable := make([]map[string]interface{}, len(guilds))
+	for idx := range guilds {
+		unavailable[idx] = map[string]interface{}{"id": guilds[idx].Id, "unavailable": true}
+	}
+
+	dat := map[string]interface{}{
+		"v":                  10,
+		"session_id":         "session",
+		"resume_gateway_url": srv.Gateway,
+		"shard":              []int{0, 1},
+		"user":               srv.User,
+		"guilds":             unavailable,
+		"application":        map[string]interface{}{"id": srv.Application, "flags": 0},
+	}
+
+	err := srv.dispatch(conn, "READY", dat)
+	if err != nil {
+		return err
+	}
+
+	for idx := range guilds {
+		err := srv.dispatch(conn, "GUILD_CREATE", guilds[idx])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (srv *Server) voiceState(conn *conn, raw json.RawMessage) error {
+	var update struct {
+		GuildId   string  `json:"guild_id"`
+		ChannelId *string `json:"channel_id"`
+		SelfMute  bool    `json:"self_mute"`
+		SelfDeaf  bool    `json:"self_deaf"`
+	}
+
+	err := json.Unmarshal(raw, &update)
+	if err != nil {
+		return err
+	}
+
+	state := map[string]interface{}{
+		"guild_id":   update.GuildId,
+		"channel_id": update.ChannelId,
+		"user_id":    srv.User.Id,
+		"session_id": "session",
+		"self_mute":  update.SelfMute,
+		"self_deaf":  update.SelfDeaf,
+		"member":     map[string]interface{}{"user": srv.User},
+	}
+
+	err = srv.dispatch(conn, "VOICE_STATE_UPDATE", state)
+	if err != nil {
+		return err
+	}
+
+	if update.ChannelId == nil {
+		return nil
+	}
+
+	server := map[string]interface{}{
+		"token":    "voice",
+		"guild_id": update.GuildId,
+		"endpoint": srv.Voice,
+	}
+
+	return srv.dispatch(conn, "VOICE_SERVER_UPDATE", server)
+}
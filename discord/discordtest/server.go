@@ -0,0 +1,301 @@
+package discordtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"zundago/discord"
+)
+
+const (
+	api = "/api/v10/"
+)
+
+type Server struct {
+	URL         string
+	Gateway     string
+	Voice       string
+	User        discord.Bot
+	Application string
+	Modes       []string
+	http        *httptest.Server
+	udp         *net.UDPConn
+	key         [32]byte
+	mode        string
+	ssrc        uint32
+	mutex       *sync.Mutex
+	signal      chan struct{}
+	routes      map[string]Handler
+	requests    []Request
+	payloads    []Payload
+	conns       map[*conn]bool
+	voices      map[*conn]bool
+	peers       map[string]*net.UDPAddr
+	guilds      []discord.Guild
+	seq         int
+	frames      chan []byte
+}
+
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+type Payload struct {
+	Op    int             `json:"op"`
+	T     string          `json:"t,omitempty"`
+	S     int             `json:"s,omitempty"`
+	D     json.RawMessage `json:"d"`
+	Voice bool            `json:"-"`
+}
+
+type Handler func(req *Request) (int, interface{})
+
+func New() *Server {
+	srv := &Server{
+		User:        discord.Bot{Id: "100000000000000001", Username: "zundamon", Discriminator: "0000"},
+		Application: "100000000000000002",
+		Modes:       []string{"aead_aes256_gcm_rtpsize", "aead_xchacha20_poly1305_rtpsize", "xsalsa20_poly1305"},
+		ssrc:        1,
+		mutex:       new(sync.Mutex),
+		signal:      make(chan struct{}),
+		routes:      make(map[string]Handler),
+		conns:       make(map[*conn]bool),
+		voices:      make(map[*conn]bool),
+		peers:       make(map[string]*net.UDPAddr),
+		frames:      make(chan []byte, 4096),
+	}
+
+	for idx := range srv.key {
+		srv.key[idx] = byte(idx)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(api, srv.rest)
+	mux.HandleFunc("/gateway", srv.gateway)
+	mux.HandleFunc("/gateway/", srv.gateway)
+	mux.HandleFunc("/voice/", srv.voice)
+
+	srv.http = httptest.NewServer(mux)
+
+	host := strings.TrimPrefix(srv.http.URL, "http://")
+	srv.URL = srv.http.URL + api
+	srv.Gateway = "ws://" + host + "/gateway"
+	srv.Voice = "ws://" + host + "/voice"
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		panic(err)
+	}
+	srv.udp = udp
+
+	go srv.listen()
+
+	return srv
+}
+
+func (srv *Server) Close() {
+	srv.mutex.Lock()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	for conn := range srv.voices {
+		conn.Close()
+	}
+	srv.mutex.Unlock()
+
+	srv.udp.Close()
+	srv.http.Close()
+}
+
+func (srv *Server) Handle(method string, route string, handler Handler) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.routes[method+" "+route] = handler
+}
+
+func (srv *Server) AddGuild(guild discord.Guild) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.guilds = append(srv.guilds, guild)
+}
+
+func (srv *Server) Requests() []Request {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	return append([]Request(nil), srv.requests...)
+}
+
+func (srv *Server) Payloads() []Payload {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	return append([]Payload(nil), srv.payloads...)
+}
+
+func (srv *Server) Frames() <-chan []byte {
+	return srv.frames
+}
+
+func (srv *Server) WaitRequest(method string, route string, timeout time.Duration) (Request, error) {
+	var found Request
+
+	ok := srv.await(func() bool {
+		for _, req := range srv.requests {
+			if req.Method == method && match(route, req.Path) {
+				found = req
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return Request{}, errors.New("timed out waiting for " + method + " " + route)
+	}
+
+	return found, nil
+}
+
+func (srv *Server) WaitGateway(op int, timeout time.Duration) (Payload, error) {
+	return srv.waitPayload(false, op, timeout)
+}
+
+func (srv *Server) WaitVoice(op int, timeout time.Duration) (Payload, error) {
+	return srv.waitPayload(true, op, timeout)
+}
+
+func (srv *Server) waitPayload(voice bool, op int, timeout time.Duration) (Payload, error) {
+	var found Payload
+
+	ok := srv.await(func() bool {
+		for _, payload := range srv.payloads {
+			if payload.Voice == voice && payload.Op == op {
+				found = payload
+				return true
+			}
+		}
+		return false
+	}, timeout)
+	if !ok {
+		return Payload{}, errors.New("timed out waiting for payload")
+	}
+
+	return found, nil
+}
+
+func (srv *Server) await(check func() bool, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+
+	for {
+		srv.mutex.Lock()
+		ok := check()
+		signal := srv.signal
+		srv.mutex.Unlock()
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-signal:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func (srv *Server) notify() {
+	close(srv.signal)
+	srv.signal = make(chan struct{})
+}
+
+func (srv *Server) rest(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := Request{
+		Method: req.Method,
+		Path:   strings.TrimPrefix(req.URL.Path, api),
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+
+	srv.mutex.Lock()
+	srv.requests = append(srv.requests, request)
+	srv.notify()
+
+	var handler Handler
+	for key, route := range srv.routes {
+		spl := strings.SplitN(key, " ", 2)
+		if spl[0] == request.Method && match(spl[1], request.Path) {
+			handler = route
+			break
+		}
+	}
+	srv.mutex.Unlock()
+
+	if handler == nil {
+		handler = srv.fallback
+	}
+
+	status, val := handler(&request)
+	if val == nil {
+		res.WriteHeader(status)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(val)
+}
+
+func (srv *Server) fallback(req *Request) (int, interface{}) {
+	if req.Method == http.MethodGet && req.Path == "gateway/bot" {
+		return http.StatusOK, map[string]interface{}{
+			"url":    srv.Gateway,
+			"shards": 1,
+			"session_start_limit": map[string]interface{}{
+				"total":           1000,
+				"remaining":       1000,
+				"reset_after":     0,
+				"max_concurrency": 1,
+			},
+		}
+	}
+
+	return http.StatusNoContent, nil
+}
+
+func match(route string, path string) bool {
+	want := strings.Split(strings.Trim(route, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(want) != len(got) {
+		return false
+	}
+
+	for idx := range want {
+		if want[idx] != "*" && want[idx] != got[idx] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,277 @@
+package discordtest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+func (srv *Server) voice(res http.ResponseWriter, req *http.Request) {
+	conn, err := upgrade(res, req)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	srv.mutex.Lock()
+	srv.voices[conn] = true
+	srv.mutex.Unlock()
+
+	defer func() {
+		srv.mutex.Lock()
+		delete(srv.voices, conn)
+		srv.mutex.Unlock()
+	}()
+
+	err = conn.send(map[string]interface{}{"op": 8, "d": map[string]interface{}{"heartbeat_interval": 13750}})
+	if err != nil {
+		return
+	}
+
+	port := srv.udp.LocalAddr().(*net.UDPAddr).Port
+
+	for {
+		payload, err := conn.next()
+		if err != nil {
+			return
+		}
+
+		payload.Voice = true
+		srv.record(payload)
+
+		switch payload.Op {
+		case 0:
+			srv.mutex.Lock()
+			modes := srv.Modes
+			srv.mutex.Unlock()
+
+			dat := map[string]interface{}{
+				"ssrc":  srv.ssrc,
+				"ip":    "127.0.0.1",
+				"port":  port,
+				"modes": modes,
+			}
+			err = conn.send(map[string]interface{}{"op": 2, "d": dat})
+		case 1:
+			var sel struct {
+				Data struct {
+					Mode string `json:"mode"`
+				} `json:"data"`
+			}
+
+			err = json.Unmarshal(payload.D, &sel)
+			if err != nil {
+				return
+			}
+
+			srv.mutex.Lock()
+			supported := false
+			for _, mode := range srv.Modes {
+				supported = supported || mode == sel.Data.Mode
+			}
+			if supported {
+				srv.mode = sel.Data.Mode
+			}
+			srv.mutex.Unlock()
+
+			if !supported {
+				conn.WriteClose(4016)
+				return
+			}
+
+			dat := map[string]interface{}{
+				"mode":       sel.Data.Mode,
+				"secret_key": srv.key,
+			}
+			err = conn.send(map[string]interface{}{"op": 4, "d": dat})
+		case 3:
+			err = conn.send(map[string]interface{}{"op": 6, "d": payload.D})
+		case 7:
+			err = conn.send(map[string]interface{}{"op": 9, "d": nil})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (srv *Server) DisconnectVoice(code int) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	for conn := range srv.voices {
+		conn.WriteClose(code)
+		conn.Close()
+	}
+}
+
+func (srv *Server) Speak(user string, ssrc uint32, frames ...[]byte) error {
+	srv.mutex.Lock()
+	conns := make([]*conn, 0, len(srv.voices))
+	for conn := range srv.voices {
+		conns = append(conns, conn)
+	}
+	peers := make([]*net.UDPAddr, 0, len(srv.peers))
+	for _, adr := range srv.peers {
+		peers = append(peers, adr)
+	}
+	srv.mutex.Unlock()
+
+	if len(conns) == 0 || len(peers) == 0 {
+		return errors.New("no voice connections")
+	}
+
+	for _, conn := range conns {
+		err := conn.send(map[string]interface{}{"op": 5, "d": map[string]interface{}{"user_id": user, "ssrc": ssrc, "speaking": 1}})
+		if err != nil {
+			return err
+		}
+	}
+
+	time.Sleep(time.Millisecond * 50)
+
+	for idx, frame := range frames {
+		head := make([]byte, 12)
+		head[0] = 0x90
+		head[1] = 0x78
+		binary.BigEndian.PutUint16(head[2:4], uint16(idx))
+		binary.BigEndian.PutUint32(head[4:8], uint32(idx*960))
+		binary.BigEndian.PutUint32(head[8:12], ssrc)
+
+		ext := []byte{0xbe, 0xde, 0x00, 0x01}
+		body := []byte{0x51, 0x00, 0x00, 0x00}
+
+		pkt, err := srv.seal(head, ext, append(body, frame...), uint32(idx))
+		if err != nil {
+			return err
+		}
+
+		for _, adr := range peers {
+			_, err := srv.udp.WriteToUDP(pkt, adr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (srv *Server) listen() {
+	buf := make([]byte, 1<<16)
+
+	for {
+		ln, adr, err := srv.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		pkt := buf[:ln]
+
+		if ln == 70 && pkt[0] != 0x80 {
+			resp := make([]byte, 70)
+			copy(resp, adr.IP.String())
+			binary.BigEndian.PutUint16(resp[68:], uint16(adr.Port))
+
+			srv.mutex.Lock()
+			srv.peers[adr.String()] = adr
+			srv.mutex.Unlock()
+
+			srv.udp.WriteToUDP(resp, adr)
+			continue
+		}
+
+		frame, ok := srv.open(pkt)
+		if !ok {
+			continue
+		}
+
+		select {
+		case srv.frames <- frame:
+		default:
+		}
+	}
+}
+
+func (srv *Server) aead() (cipher.AEAD, error) {
+	srv.mutex.Lock()
+	mode := srv.mode
+	srv.mutex.Unlock()
+
+	switch mode {
+	case "aead_aes256_gcm_rtpsize":
+		block, err := aes.NewCipher(srv.key[:])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case "aead_xchacha20_poly1305_rtpsize":
+		return chacha20poly1305.NewX(srv.key[:])
+	}
+
+	return nil, nil
+}
+
+func (srv *Server) seal(head []byte, ext []byte, data []byte, count uint32) ([]byte, error) {
+	aead, err := srv.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if aead == nil {
+		var nonce [24]byte
+		copy(nonce[:], head)
+
+		return secretbox.Seal(head, append(ext, data...), &nonce, &srv.key), nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, count)
+
+	head = append(head, ext...)
+	pkt := make([]byte, len(head), len(head)+len(data)+aead.Overhead()+4)
+	copy(pkt, head)
+	pkt = aead.Seal(pkt, nonce, data, head)
+
+	return append(pkt, nonce[:4]...), nil
+}
+
+func (srv *Server) open(pkt []byte) ([]byte, bool) {
+	aead, err := srv.aead()
+	if err != nil || len(pkt) < 12 {
+		return nil, false
+	}
+
+	if aead == nil {
+		if len(pkt) < 12+secretbox.Overhead {
+			return nil, false
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], pkt[:12])
+
+		return secretbox.Open(nil, pkt[12:], &nonce, &srv.key)
+	}
+
+	if len(pkt) < 12+aead.Overhead()+4 {
+		return nil, false
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, pkt[len(pkt)-4:])
+
+	frame, err := aead.Open(nil, nonce, pkt[12:len(pkt)-4], pkt[:12])
+	if err != nil {
+		return nil, false
+	}
+
+	return frame, true
+}
@@ -0,0 +1,208 @@
+package discord
+
+import (
+	"errors"
+	"strconv"
+)
+
+func (int *Interaction) Subcommand() (string, string) {
+	opts := int.Data.Options
+	if len(opts) == 0 {
+		return "", ""
+	}
+
+	switch opts[0].Type {
+	case SubcommandGroupOption:
+		if len(opts[0].Options) > 0 {
+			return opts[0].Name, opts[0].Options[0].Name
+		}
+		return opts[0].Name, ""
+	case SubcommandOption:
+		return "", opts[0].Name
+	}
+
+	return "", ""
+}
+
+func (int *Interaction) Options() *Options {
+	opts := int.Data.Options
+	for len(opts) > 0 && (opts[0].Type == SubcommandOption || opts[0].Type == SubcommandGroupOption) {
+		opts = opts[0].Options
+	}
+
+	return &Options{
+		list:     opts,
+		resolved: &int.Data.Resolved,
+	}
+}
+
+func (opts *Options) Has(name string) bool {
+	_, err := opts.option(name)
+	return err == nil
+}
+
+func (opts *Options) String(name string) (string, error) {
+	opt, err := opts.option(name, StringOption)
+	if err != nil {
+		return "", err
+	}
+
+	val, ok := opt.Value.(string)
+	if !ok {
+		return "", errors.New("option (" + name + ") has no string value")
+	}
+
+	return val, nil
+}
+
+func (opts *Options) Int(name string) (int, error) {
+	opt, err := opts.option(name, IntOption)
+	if err != nil {
+		return 0, err
+	}
+
+	val, ok := opt.Value.(float64)
+	if !ok {
+		return 0, errors.New("option (" + name + ") has no integer value")
+	}
+
+	return int(val), nil
+}
+
+func (opts *Options) Float(name string) (float64, error) {
+	opt, err := opts.option(name, NumOption)
+	if err != nil {
+		return 0, err
+	}
+
+	val, ok := opt.Value.(float64)
+	if !ok {
+		return 0, errors.New("option (" + name + ") has no number value")
+	}
+
+	return val, nil
+}
+
+func (opts *Options) Bool(name string) (bool, error) {
+	opt, err := opts.option(name, BoolOption)
+	if err != nil {
+		return false, err
+	}
+
+	val, ok := opt.Value.(bool)
+	if !ok {
+		return false, errors.New("option (" + name + ") has no boolean value")
+	}
+
+	return val, nil
+}
+
+func (opts *Options) User(name string) (*User, error) {
+	id, err := opts.snowflake(name, UserOption, MentionOption)
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := opts.resolved.Users[id]
+	if !ok {
+		return nil, errors.New("option (" + name + ") could not be resolved")
+	}
+
+	return user, nil
+}
+
+func (opts *Options) Member(name string) (*Member, error) {
+	id, err := opts.snowflake(name, UserOption, MentionOption)
+	if err != nil {
+		return nil, err
+	}
+
+	member, ok := opts.resolved.Members[id]
+	if !ok {
+		return nil, errors.New("option (" + name + ") could not be resolved")
+	}
+
+	if user, ok := opts.resolved.Users[id]; ok {
+		member.User = *user
+	}
+
+	return member, nil
+}
+
+func (opts *Options) Channel(name string) (*Channel, error) {
+	id, err := opts.snowflake(name, ChannelOption)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, ok := opts.resolved.Channels[id]
+	if !ok {
+		return nil, errors.New("option (" + name + ") could not be resolved")
+	}
+
+	return channel, nil
+}
+
+func (opts *Options) Role(name string) (*Role, error) {
+	id, err := opts.snowflake(name, RoleOption, MentionOption)
+	if err != nil {
+		return nil, err
+	}
+
+	role, ok := opts.resolved.Roles[id]
+	if !ok {
+		return nil, errors.New("option (" + name + ") could not be resolved")
+	}
+
+	return role, nil
+}
+
+func (opts *Options) Attachment(name string) (*Attachment, error) {
+	id, err := opts.snowflake(name, AttachmentOption)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment, ok := opts.resolved.Attachments[id]
+	if !ok {
+		return nil, errors.New("option (" + name + ") could not be resolved")
+	}
+
+	return attachment, nil
+}
+
+func (opts *Options) snowflake(name string, types ...int) (string, error) {
+	opt, err := opts.option(name, types...)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := opt.Value.(string)
+	if !ok {
+		return "", errors.New("option (" + name + ") has no id value")
+	}
+
+	return id, nil
+}
+
+func (opts *Options) option(name string, types ...int) (*Option, error) {
+	for idx := range opts.list {
+		if opts.list[idx].Name != name {
+			continue
+		}
+
+		if len(types) == 0 {
+			return &opts.list[idx], nil
+		}
+
+		for _, typ := range types {
+			if opts.list[idx].Type == typ {
+				return &opts.list[idx], nil
+			}
+		}
+
+		return nil, errors.New("option (" + name + ") has type " + strconv.Itoa(opts.list[idx].Type))
+	}
+
+	return nil, errors.New("option (" + name + ") not provided")
+}
@@ -0,0 +1,224 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	agent   = "DiscordBot (https://github.com/Tailmc/zundago, 1.0)"
+	retries = 3
+)
+
+type rest struct {
+	host    string
+	sec     string
+	client  *http.Client
+	mutex   *sync.Mutex
+	global  time.Time
+	swept   time.Time
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	left  int
+	reset time.Time
+	users int
+	*sync.Mutex
+}
+
+func newRest(tok string) *rest {
+	return &rest{
+		host:    HOST,
+		sec:     tok,
+		client:  client,
+		mutex:   new(sync.Mutex),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (rest *rest) json(method string, route string, val interface{}, out interface{}) error {
+	if val == nil {
+		return rest.do(method, route, "", nil, out)
+	}
+
+	body, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	return rest.do(method, route, "application/json", body, out)
+}
+
+func (rest *rest) multipart(method string, route string, dat map[string]interface{}, fls []File, out interface{}) error {
+	body, boundary, err := multiPart(dat, fls)
+	if err != nil {
+		return err
+	}
+
+	return rest.do(method, route, "multipart/form-data; boundary="+boundary, body, out)
+}
+
+func (rest *rest) do(method string, route string, typ string, body []byte, out interface{}) error {
+	bkt := rest.bucket(method, route)
+	defer rest.release(bkt)
+
+	for try := 0; ; try++ {
+		bkt.Lock()
+
+		rest.mutex.Lock()
+		global := rest.global
+		rest.mutex.Unlock()
+
+		time.Sleep(time.Until(global))
+		if bkt.left == 0 {
+			time.Sleep(time.Until(bkt.reset))
+		}
+
+		req, err := http.NewRequest(method, rest.host+route, bytes.NewReader(body))
+		if err != nil {
+			bkt.Unlock()
+			return err
+		}
+
+		req.Header.Set("User-Agent", agent)
+		if rest.sec != "" {
+			req.Header.Set("Authorization", "Bot "+rest.sec)
+		}
+		if typ != "" {
+			req.Header.Set("Content-Type", typ)
+		}
+
+		res, err := rest.client.Do(req)
+		if err != nil {
+			bkt.Unlock()
+			return err
+		}
+
+		bkt.update(res.Header)
+		bkt.Unlock()
+
+		if res.StatusCode == http.StatusTooManyRequests {
+			limit := new(RateLimit)
+			json.NewDecoder(res.Body).Decode(limit)
+			res.Body.Close()
+
+			if limit.RetryAfter == 0 {
+				limit.RetryAfter, _ = strconv.ParseFloat(res.Header.Get("Retry-After"), 64)
+			}
+
+			wait := time.Duration(limit.RetryAfter * float64(time.Second))
+			if limit.Global || res.Header.Get("X-RateLimit-Global") == "true" {
+				limit.Global = true
+				rest.mutex.Lock()
+				rest.global = time.Now().Add(wait)
+				rest.mutex.Unlock()
+			}
+
+			if try >= retries {
+				return limit
+			}
+
+			time.Sleep(wait)
+			continue
+		}
+
+		defer res.Body.Close()
+		if res.StatusCode/100 != 2 {
+			err := &Error{Status: res.StatusCode}
+			json.NewDecoder(res.Body).Decode(err)
+			return err
+		}
+
+		if out != nil && res.StatusCode != http.StatusNoContent {
+			return json.NewDecoder(res.Body).Decode(out)
+		}
+
+		_, err = io.Copy(io.Discard, res.Body)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+func (rest *rest) bucket(method string, route string) *bucket {
+	key := method + " " + major(route)
+
+	rest.mutex.Lock()
+	defer rest.mutex.Unlock()
+
+	if now := time.Now(); now.Sub(rest.swept) > time.Minute {
+		rest.swept = now
+		for key, bkt := range rest.buckets {
+			if bkt.users == 0 && now.After(bkt.reset) {
+				delete(rest.buckets, key)
+			}
+		}
+	}
+
+	bkt, ok := rest.buckets[key]
+	if !ok {
+		bkt = &bucket{left: 1, Mutex: new(sync.Mutex)}
+		rest.buckets[key] = bkt
+	}
+	bkt.users++
+
+	return bkt
+}
+
+func (rest *rest) release(bkt *bucket) {
+
+	rest.mutex.Lock()
+	defer rest.mutex.Unlock()
+
+	bkt.users--
+}
+
+func (bkt *bucket) update(head http.Header) {
+	left, err := strconv.Atoi(head.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	after, err := strconv.ParseFloat(head.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return
+	}
+
+	bkt.left = left
+	bkt.reset = time.Now().Add(time.Duration(after * float64(time.Second)))
+}
+
+func major(route string) string {
+	route = strings.SplitN(route, "?", 2)[0]
+	parts := strings.Split(route, "/")
+
+	for idx := 1; idx < len(parts); idx++ {
+		switch parts[idx-1] {
+		case "channels", "guilds", "webhooks":
+			continue
+		case "interactions":
+			parts[idx] = ":id"
+			continue
+		}
+
+		if idx > 1 && (parts[idx-2] == "webhooks" || parts[idx-2] == "interactions") {
+			parts[idx] = ":token"
+			continue
+		}
+
+		if _, err := strconv.ParseUint(parts[idx], 10, 64); err == nil {
+			parts[idx] = ":id"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,51 @@
+package discord
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMajor(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{"channels/300000000000000001/messages/600000000000000001", "channels/300000000000000001/messages/:id"},
+		{"guilds/200000000000000001/members?limit=1000", "guilds/200000000000000001/members"},
+		{"interactions/700000000000000001/aW50ZXJhY3Rpb24/callback", "interactions/:id/:token/callback"},
+		{"webhooks/100000000000000002/aW50ZXJhY3Rpb24/messages/@original", "webhooks/100000000000000002/:token/messages/@original"},
+		{"applications/100000000000000002/guilds/200000000000000001/commands", "applications/:id/guilds/200000000000000001/commands"},
+	}
+
+	for _, test := range tests {
+		if got := major(test.route); got != test.want {
+			t.Errorf("%s: got %s want %s", test.route, got, test.want)
+		}
+	}
+}
+
+func TestBucketEviction(t *testing.T) {
+	rest := newRest("")
+
+	for _, tok := range []string{"a", "b", "c"} {
+		rest.release(rest.bucket("POST", "interactions/700000000000000001/"+tok+"/callback"))
+	}
+	if len(rest.buckets) != 1 {
+		t.Fatalf("got %d buckets want 1", len(rest.buckets))
+	}
+
+	held := rest.bucket("GET", "channels/300000000000000001/messages")
+	rest.release(rest.bucket("GET", "channels/300000000000000002/messages"))
+
+	rest.swept = time.Time{}
+	rest.release(rest.bucket("GET", "channels/300000000000000003/messages"))
+
+	if _, ok := rest.buckets["GET channels/300000000000000001/messages"]; !ok {
+		t.Error("evicted a bucket in use")
+	}
+	if _, ok := rest.buckets["GET channels/300000000000000002/messages"]; ok {
+		t.Error("kept an expired idle bucket")
+	}
+
+	rest.release(held)
+}
@@ -0,0 +1,477 @@
+package discord
+
+import (
+	"sync"
+)
+
+type Cache int
+
+const (
+	CacheGuilds Cache = 1 << iota
+	CacheChannels
+	CacheMembers
+	CacheRoles
+	CacheVoiceStates
+	CachePresences
+)
+
+const (
+	CacheAll = CacheGuilds | CacheChannels | CacheMembers | CacheRoles | CacheVoiceStates | CachePresences
+)
+
+type State struct {
+	flags     Cache
+	guilds    map[string]*Guild
+	channels  map[string]map[string]*Channel
+	owners    map[string]string
+	members   map[string]map[string]*Member
+	roles     map[string]map[string]*Role
+	states    map[string]map[string]*VoiceState
+	presences map[string]map[string]*PresenceUpdate
+	voices    map[string]*Voice
+	*sync.RWMutex
+}
+
+func newState() *State {
+	return &State{
+		flags:     CacheAll,
+		guilds:    make(map[string]*Guild),
+		channels:  make(map[string]map[string]*Channel),
+		owners:    make(map[string]string),
+		members:   make(map[string]map[string]*Member),
+		roles:     make(map[string]map[string]*Role),
+		states:    make(map[string]map[string]*VoiceState),
+		presences: make(map[string]map[string]*PresenceUpdate),
+		voices:    make(map[string]*Voice),
+		RWMutex:   new(sync.RWMutex),
+	}
+}
+
+func (state *State) Guild(id string) (Guild, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	stored, ok := state.guilds[id]
+	if !ok {
+		return Guild{}, false
+	}
+
+	guild := *stored
+
+	if me, ok := state.members[id][guild.ClientId]; ok {
+		guild.Me = *me
+	}
+
+	return guild, true
+}
+
+func (state *State) Channel(id string) (Channel, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	channel, ok := state.channels[state.owners[id]][id]
+	if !ok {
+		return Channel{}, false
+	}
+
+	return *channel, true
+}
+
+func (state *State) Channels(guild string) []Channel {
+	state.RLock()
+	defer state.RUnlock()
+
+	channels := make([]Channel, 0, len(state.channels[guild]))
+	for _, channel := range state.channels[guild] {
+		channels = append(channels, *channel)
+	}
+
+	return channels
+}
+
+func (state *State) Member(guild string, user string) (Member, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	member, ok := state.members[guild][user]
+	if !ok {
+		return Member{}, false
+	}
+
+	return *member, true
+}
+
+func (state *State) Members(guild string) []Member {
+	state.RLock()
+	defer state.RUnlock()
+
+	members := make([]Member, 0, len(state.members[guild]))
+	for _, member := range state.members[guild] {
+		members = append(members, *member)
+	}
+
+	return members
+}
+
+func (state *State) Role(guild string, id string) (Role, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	role, ok := state.roles[guild][id]
+	if !ok {
+		return Role{}, false
+	}
+
+	return *role, true
+}
+
+func (state *State) Roles(guild string) []Role {
+	state.RLock()
+	defer state.RUnlock()
+
+	roles := make([]Role, 0, len(state.roles[guild]))
+	for _, role := range state.roles[guild] {
+		roles = append(roles, *role)
+	}
+
+	return roles
+}
+
+func (state *State) VoiceState(guild string, user string) (VoiceState, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	voiceState, ok := state.states[guild][user]
+	if !ok {
+		return VoiceState{}, false
+	}
+
+	return *voiceState, true
+}
+
+func (state *State) VoiceStates(guild string) []VoiceState {
+	state.RLock()
+	defer state.RUnlock()
+
+	voiceStates := make([]VoiceState, 0, len(state.states[guild]))
+	for _, voiceState := range state.states[guild] {
+		voiceStates = append(voiceStates, *voiceState)
+	}
+
+	return voiceStates
+}
+
+func (state *State) Presence(guild string, user string) (PresenceUpdate, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	presence, ok := state.presences[guild][user]
+	if !ok {
+		return PresenceUpdate{}, false
+	}
+
+	return *presence, true
+}
+
+func (state *State) Voice(guild string) (*Voice, bool) {
+	state.RLock()
+	defer state.RUnlock()
+
+	voice, ok := state.voices[guild]
+
+	return voice, ok
+}
+
+func (state *State) setFlags(flags Cache) {
+	state.Lock()
+	defer state.Unlock()
+
+	state.flags = flags
+}
+
+func (state *State) reset() {
+	state.Lock()
+	defer state.Unlock()
+
+	state.guilds = make(map[string]*Guild)
+	state.channels = make(map[string]map[string]*Channel)
+	state.owners = make(map[string]string)
+	state.members = make(map[string]map[string]*Member)
+	state.roles = make(map[string]map[string]*Role)
+	state.states = make(map[string]map[string]*VoiceState)
+	state.presences = make(map[string]map[string]*PresenceUpdate)
+	state.voices = make(map[string]*Voice)
+}
+
+func (state *State) setGuild(guild *Guild) {
+	state.Lock()
+	defer state.Unlock()
+
+	state.clearGuild(guild.Id)
+
+	if state.flags&CacheChannels != 0 {
+		for idx := range guild.Channels {
+			channel := guild.Channels[idx]
+			channel.GuildId = guild.Id
+			state.putChannel(&channel)
+		}
+	}
+
+	if state.flags&CacheRoles != 0 {
+		for idx := range guild.Roles {
+			role := guild.Roles[idx]
+			role.GuildId = guild.Id
+			state.putRole(&role)
+		}
+	}
+
+	if state.flags&CacheMembers != 0 {
+		for idx := range guild.Members {
+			member := guild.Members[idx]
+			member.GuildId = guild.Id
+			state.putMember(&member)
+		}
+	}
+
+	if state.flags&CacheVoiceStates != 0 {
+		for idx := range guild.VoiceStates {
+			voiceState := guild.VoiceStates[idx]
+			voiceState.GuildID = guild.Id
+			state.putVoiceState(&voiceState)
+		}
+	}
+
+	if state.flags&CachePresences != 0 {
+		for idx := range guild.Presences {
+			presence := guild.Presences[idx]
+			presence.GuildId = guild.Id
+			state.putPresence(&presence)
+		}
+	}
+
+	if state.flags&CacheGuilds == 0 {
+		return
+	}
+
+	stored := *guild
+	stored.Channels = nil
+	stored.Roles = nil
+	stored.Members = nil
+	stored.VoiceStates = nil
+	stored.Presences = nil
+
+	state.guilds[guild.Id] = &stored
+}
+
+func (state *State) updateGuild(guild *Guild) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CacheRoles != 0 {
+		state.roles[guild.Id] = make(map[string]*Role, len(guild.Roles))
+		for idx := range guild.Roles {
+			role := guild.Roles[idx]
+			role.GuildId = guild.Id
+			state.putRole(&role)
+		}
+	}
+
+	if state.flags&CacheGuilds == 0 {
+		return
+	}
+
+	stored := *guild
+	stored.Channels = nil
+	stored.Roles = nil
+	stored.Members = nil
+	stored.VoiceStates = nil
+	stored.Presences = nil
+
+	if old, ok := state.guilds[guild.Id]; ok {
+		stored.JoinedAT = old.JoinedAT
+		stored.Large = old.Large
+		stored.MemberCount = old.MemberCount
+	}
+
+	state.guilds[guild.Id] = &stored
+}
+
+func (state *State) deleteGuild(id string) {
+	state.Lock()
+	defer state.Unlock()
+
+	delete(state.guilds, id)
+	state.clearGuild(id)
+}
+
+func (state *State) clearGuild(id string) {
+	for channel := range state.channels[id] {
+		delete(state.owners, channel)
+	}
+
+	delete(state.channels, id)
+	delete(state.members, id)
+	delete(state.roles, id)
+	delete(state.states, id)
+	delete(state.presences, id)
+}
+
+func (state *State) setChannel(channel *Channel) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CacheChannels == 0 {
+		return
+	}
+
+	stored := *channel
+	state.putChannel(&stored)
+}
+
+func (state *State) deleteChannel(id string) {
+	state.Lock()
+	defer state.Unlock()
+
+	delete(state.channels[state.owners[id]], id)
+	delete(state.owners, id)
+}
+
+func (state *State) setMember(member *Member) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CacheMembers == 0 {
+		return
+	}
+
+	stored := *member
+	state.putMember(&stored)
+}
+
+func (state *State) deleteMember(guild string, user string) {
+	state.Lock()
+	defer state.Unlock()
+
+	delete(state.members[guild], user)
+	delete(state.presences[guild], user)
+}
+
+func (state *State) setRole(role *Role) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CacheRoles == 0 {
+		return
+	}
+
+	stored := *role
+	state.putRole(&stored)
+}
+
+func (state *State) deleteRole(guild string, id string) {
+	state.Lock()
+	defer state.Unlock()
+
+	delete(state.roles[guild], id)
+}
+
+func (state *State) setVoiceState(voiceState *VoiceState) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CacheVoiceStates == 0 {
+		return
+	}
+
+	stored := *voiceState
+	state.putVoiceState(&stored)
+}
+
+func (state *State) setPresence(presence *PresenceUpdate) {
+	state.Lock()
+	defer state.Unlock()
+
+	if state.flags&CachePresences == 0 {
+		return
+	}
+
+	stored := *presence
+	state.putPresence(&stored)
+}
+
+func (state *State) setVoice(voice *Voice) {
+	state.Lock()
+	defer state.Unlock()
+
+	state.voices[voice.GuildId] = voice
+}
+
+func (state *State) deleteVoice(guild string) {
+	state.Lock()
+	defer state.Unlock()
+
+	delete(state.voices, guild)
+}
+
+func (state *State) voiceGuilds() []string {
+	state.RLock()
+	defer state.RUnlock()
+
+	guilds := make([]string, 0, len(state.voices))
+	for guild := range state.voices {
+		guilds = append(guilds, guild)
+	}
+
+	return guilds
+}
+
+func (state *State) putChannel(channel *Channel) {
+	if state.channels[channel.GuildId] == nil {
+		state.channels[channel.GuildId] = make(map[string]*Channel)
+	}
+
+	state.channels[channel.GuildId][channel.Id] = channel
+	state.owners[channel.Id] = channel.GuildId
+}
+
+func (state *State) putMember(member *Member) {
+	if state.members[member.GuildId] == nil {
+		state.members[member.GuildId] = make(map[string]*Member)
+	}
+
+	state.members[member.GuildId][member.User.Id] = member
+}
+
+func (state *State) putRole(role *Role) {
+	if state.roles[role.GuildId] == nil {
+		state.roles[role.GuildId] = make(map[string]*Role)
+	}
+
+	state.roles[role.GuildId][role.Id] = role
+}
+
+func (state *State) putVoiceState(voiceState *VoiceState) {
+	if voiceState.ChannelID == "" {
+		delete(state.states[voiceState.GuildID], voiceState.UserID)
+		return
+	}
+
+	if state.states[voiceState.GuildID] == nil {
+		state.states[voiceState.GuildID] = make(map[string]*VoiceState)
+	}
+
+	state.states[voiceState.GuildID][voiceState.UserID] = voiceState
+}
+
+func (state *State) putPresence(presence *PresenceUpdate) {
+	if presence.Status == Offline {
+		delete(state.presences[presence.GuildId], presence.User.Id)
+		return
+	}
+
+	if state.presences[presence.GuildId] == nil {
+		state.presences[presence.GuildId] = make(map[string]*PresenceUpdate)
+	}
+
+	state.presences[presence.GuildId][presence.User.Id] = presence
+}
@@ -0,0 +1,36 @@
+package discord
+
+import "testing"
+
+func TestStateGuild(t *testing.T) {
+	state := newState()
+
+	state.setGuild(&Guild{
+		Id:       "200000000000000001",
+		ClientId: "100000000000000002",
+		Channels: []Channel{{Id: "300000000000000001"}, {Id: "300000000000000002"}},
+		Roles:    []Role{{Id: "200000000000000001"}},
+		Members:  []Member{{User: User{Id: "100000000000000002"}}},
+	})
+
+	guild, ok := state.Guild("200000000000000001")
+	if !ok {
+		t.Fatal("guild not cached")
+	}
+	if guild.Channels != nil || guild.Roles != nil || guild.Members != nil {
+		t.Errorf("got entities on guild %+v", guild)
+	}
+	if guild.Me.User.Id != "100000000000000002" {
+		t.Errorf("got me %+v", guild.Me)
+	}
+
+	if got := len(state.Channels("200000000000000001")); got != 2 {
+		t.Errorf("got %d channels want 2", got)
+	}
+	if got := len(state.Roles("200000000000000001")); got != 1 {
+		t.Errorf("got %d roles want 1", got)
+	}
+	if got := len(state.Members("200000000000000001")); got != 1 {
+		t.Errorf("got %d members want 1", got)
+	}
+}
@@ -1,8 +1,10 @@
 package discord
 
 import (
+	"encoding/json"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 	"zundago/socket"
 )
@@ -64,7 +66,7 @@ type Guild struct {
 	Large                       bool                     `json:"large"`
 	MemberCount                 int                      `json:"member_count"`
 	VoiceStates                 []VoiceState             `json:"voice_states"`
-	Presences                   []map[string]interface{} `json:"presences"`
+	Presences                   []PresenceUpdate         `json:"presences"`
 	Threads                     []map[string]interface{} `json:"threads"`
 	StageInstances              []map[string]interface{} `json:"stage_instances"`
 	Unavailable                 bool                     `json:"unavailable"`
@@ -168,19 +170,31 @@ type Emoji struct {
 }
 
 type Presence struct {
-	Since    int64
-	Status   Status
-	AFK      bool
-	Activity Activity
-	OnMobile bool
+	Since      int64
+	Status     Status
+	AFK        bool
+	Activity   Activity
+	Activities []Activity
+	OnMobile   bool
 }
 
 type Status string
 
+type PresenceUpdate struct {
+	User struct {
+		Id string `json:"id"`
+	} `json:"user"`
+	GuildId      string            `json:"guild_id"`
+	Status       Status            `json:"status"`
+	Activities   []Activity        `json:"activities"`
+	ClientStatus map[string]Status `json:"client_status"`
+}
+
 type Activity struct {
-	Name string       `json:"name"`
-	Type ActivityType `json:"type"`
-	URL  string       `json:"url"`
+	Name  string       `json:"name"`
+	Type  ActivityType `json:"type"`
+	URL   string       `json:"url"`
+	State string       `json:"state"`
 }
 
 type ActivityType int
@@ -211,12 +225,33 @@ type Sharding struct {
 }
 
 type Listeners struct {
-	Ready             func(bot *Bot)
-	MessageCreate     func(bot *Bot, message *Message)
-	GuildCreate       func(bot *Bot, guild *Guild)
-	GuildDelete       func(bot *Bot, guild *Guild)
-	InteractionCreate func(bot *Bot, interaction *Interaction)
-	VoiceStateUpdate  func(bot *Bot, voiceStates []VoiceState)
+	Ready               func(bot *Bot)
+	Disconnect          func(bot *Bot, err error)
+	Reconnect           func(bot *Bot)
+	Error               func(bot *Bot, err error)
+	Raw                 func(bot *Bot, event string, data json.RawMessage)
+	MessageCreate       func(bot *Bot, message *Message)
+	MessageUpdate       func(bot *Bot, message *Message)
+	MessageDelete       func(bot *Bot, message *MessageDelete)
+	MessageReactionAdd  func(bot *Bot, reaction *Reaction)
+	TypingStart         func(bot *Bot, typing *Typing)
+	GuildCreate         func(bot *Bot, guild *Guild)
+	GuildDelete         func(bot *Bot, guild *Guild)
+	GuildMemberAdd      func(bot *Bot, member *Member)
+	GuildMemberUpdate   func(bot *Bot, member *Member)
+	GuildMemberRemove   func(bot *Bot, member *Member)
+	PresenceUpdate      func(bot *Bot, presence *PresenceUpdate)
+	ChannelCreate       func(bot *Bot, channel *Channel)
+	ChannelUpdate       func(bot *Bot, channel *Channel)
+	ChannelDelete       func(bot *Bot, channel *Channel)
+	ThreadCreate        func(bot *Bot, thread *Channel)
+	ThreadUpdate        func(bot *Bot, thread *Channel)
+	ThreadDelete        func(bot *Bot, thread *Channel)
+	ThreadListSync      func(bot *Bot, threads *ThreadSync)
+	ThreadMemberUpdate  func(bot *Bot, member *ThreadMember)
+	ThreadMembersUpdate func(bot *Bot, members *ThreadMembers)
+	InteractionCreate   func(bot *Bot, interaction *Interaction)
+	VoiceStateUpdate    func(bot *Bot, voiceStates []VoiceState)
 }
 
 type Message struct {
@@ -250,22 +285,66 @@ type Message struct {
 	Stickers           []map[string]interface{} `json:"sticker_items"`
 }
 
+type MessageDelete struct {
+	Id        string `json:"id"`
+	ChannelId string `json:"channel_id"`
+	GuildId   string `json:"guild_id"`
+}
+
+type Reaction struct {
+	UserId    string `json:"user_id"`
+	ChannelId string `json:"channel_id"`
+	MessageId string `json:"message_id"`
+	GuildId   string `json:"guild_id"`
+	Member    Member `json:"member"`
+	Emoji     struct {
+		Id       string `json:"id"`
+		Name     string `json:"name"`
+		Animated bool   `json:"animated"`
+	} `json:"emoji"`
+}
+
+type Typing struct {
+	ChannelId string `json:"channel_id"`
+	GuildId   string `json:"guild_id"`
+	UserId    string `json:"user_id"`
+	Timestamp int64  `json:"timestamp"`
+	Member    Member `json:"member"`
+}
+
+type ThreadSync struct {
+	GuildId    string         `json:"guild_id"`
+	ChannelIds []string       `json:"channel_ids"`
+	Threads    []Channel      `json:"threads"`
+	Members    []ThreadMember `json:"members"`
+}
+
+type ThreadMember struct {
+	Id            string `json:"id"`
+	UserId        string `json:"user_id"`
+	GuildId       string `json:"guild_id"`
+	JoinTimestamp string `json:"join_timestamp"`
+	Flags         int    `json:"flags"`
+}
+
+type ThreadMembers struct {
+	Id               string         `json:"id"`
+	GuildId          string         `json:"guild_id"`
+	MemberCount      int            `json:"member_count"`
+	AddedMembers     []ThreadMember `json:"added_members"`
+	RemovedMemberIds []string       `json:"removed_member_ids"`
+}
+
 type Interaction struct {
 	Id            string `json:"id"`
 	ApplicationId string `json:"application_id"`
 	Type          int    `json:"type"`
 	Data          struct {
+		ComponentData
 		ID       string   `json:"id"`
 		Name     string   `json:"name"`
 		Options  []Option `json:"options"`
-		Resolved struct {
-			Users       map[string]*User       `json:"users"`
-			Members     map[string]*Member     `json:"members"`
-			Roles       map[string]*Role       `json:"roles"`
-			Channels    map[string]*Channel    `json:"channels"`
-			Messages    map[string]*Message    `json:"messages"`
-			Attachments map[string]*Attachment `json:"attachments"`
-		}
+		Resolved Resolved `json:"resolved"`
 	} `json:"data"`
 	GuildId        string  `json:"guild_id"`
 	ChannelId      string  `json:"channel_id"`
@@ -277,8 +356,22 @@ type Interaction struct {
 	GuildLocale    string  `json:"guild_locale"`
 	Message        Message `json:"message"`
 	Channel        Channel `json:"-"`
-	Guild          Guild   `json:"-"`
 	Author         Member  `json:"member"`
+	rest           *rest
+}
+
+type Resolved struct {
+	Users       map[string]*User       `json:"users"`
+	Members     map[string]*Member     `json:"members"`
+	Roles       map[string]*Role       `json:"roles"`
+	Channels    map[string]*Channel    `json:"channels"`
+	Messages    map[string]*Message    `json:"messages"`
+	Attachments map[string]*Attachment `json:"attachments"`
+}
+
+type Options struct {
+	list     []Option
+	resolved *Resolved
 }
 
 type EmbedImage struct {
@@ -318,49 +411,62 @@ type Embed struct {
 }
 
 type Command struct {
-	Name             string
-	Description      string
-	Options          []Option
-	DMPermission     bool
-	Permissions      []Permission
-	GuildId          int
-	Subcommands      []SubCommand
-	SubcommandGroups []SubcommandGroup
+	Handler                  func(bot *Bot, interaction *Interaction)
+	Autocomplete             func(bot *Bot, interaction *Interaction)
+	Name                     string
+	Description              string
+	NameLocalizations        map[string]string
+	DescriptionLocalizations map[string]string
+	Options                  []Option
+	DMPermission             bool
+	NSFW                     bool
+	Permissions              []Permission
+	GuildId                  string
+	Subcommands              []SubCommand
+	SubcommandGroups         []SubcommandGroup
 }
 
 type SubCommand struct {
-	Name        string
-	Description string
-	Options     []Option
+	Name                     string
+	Description              string
+	NameLocalizations        map[string]string
+	DescriptionLocalizations map[string]string
+	Options                  []Option
 }
 
 type SubcommandGroup struct {
-	Name        string
-	Description string
-	Subcommands []SubCommand
+	Name                     string
+	Description              string
+	NameLocalizations        map[string]string
+	DescriptionLocalizations map[string]string
+	Subcommands              []SubCommand
 }
 
 type Option struct {
-	Name         string `json:"name"`
-	Type         int    `json:"type"`
-	Description  string
-	Required     bool
-	MinLength    int
-	MaxLength    int
-	MinValue     int
-	MaxValue     int
-	MaxValueNum  float64
-	MinValueNum  float64
-	AutoComplete bool
-	ChannelTypes []int
-	Choices      []Choice
-	Value        interface{} `json:"Value"`
-	Focused      bool        `json:"focused"`
+	Name                     string `json:"name"`
+	Type                     int    `json:"type"`
+	Description              string
+	NameLocalizations        map[string]string
+	DescriptionLocalizations map[string]string
+	Required                 bool
+	MinLength                int
+	MaxLength                int
+	MinValue                 int
+	MaxValue                 int
+	MaxValueNum              float64
+	MinValueNum              float64
+	AutoComplete             bool
+	ChannelTypes             []int
+	Choices                  []Choice
+	Value                    interface{} `json:"Value"`
+	Focused                  bool        `json:"focused"`
+	Options                  []Option    `json:"options"`
 }
 
 type Choice struct {
-	Name  string      `json:"name"`
-	Value interface{} `json:"value"`
+	Name              string            `json:"name"`
+	NameLocalizations map[string]string `json:"name_localizations,omitempty"`
+	Value             interface{}       `json:"value"`
 }
 
 type Permission int
@@ -373,14 +479,41 @@ type ComponentData struct {
 }
 
 type Component struct {
-	CustomId string   `json:"custom_id"`
-	Type     int      `json:"type"`
-	Value    string   `json:"value"`
-	Values   []string `json:"values"`
+	CustomId     string         `json:"custom_id"`
+	Type         int            `json:"type"`
+	Value        string         `json:"value"`
+	Values       []string       `json:"values"`
+	Style        int            `json:"-"`
+	Label        string         `json:"-"`
+	Emoji        string         `json:"-"`
+	URL          string         `json:"-"`
+	Disabled     bool           `json:"-"`
+	Placeholder  string         `json:"-"`
+	MinValues    int            `json:"-"`
+	MaxValues    int            `json:"-"`
+	MinLength    int            `json:"-"`
+	MaxLength    int            `json:"-"`
+	Required     bool           `json:"-"`
+	Options      []SelectOption `json:"-"`
+	ChannelTypes []int          `json:"-"`
+}
+
+type SelectOption struct {
+	Label       string
+	Value       string
+	Description string
+	Emoji       string
+	Default     bool
 }
 
 type Row struct {
-	Components []Component
+	Components []Component `json:"components"`
+}
+
+type Modal struct {
+	CustomId   string
+	Title      string
+	Components []Row
 }
 
 type Attachment struct {
@@ -403,6 +536,15 @@ type Response struct {
 	Ephemeral      bool
 	SuppressEmbeds bool
 	Files          []File
+	Components     []Row
+}
+
+type Webhook struct {
+	Id        string
+	Token     string
+	Username  string
+	AvatarURL string
+	ThreadId  string
 }
 
 type File struct {
@@ -412,6 +554,7 @@ type File struct {
 }
 
 type Error struct {
+	Status  int    `json:"-"`
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 }
@@ -420,15 +563,36 @@ func (err *Error) Error() string {
 	return "[" + strconv.Itoa(err.Code) + "]:" + err.Message
 }
 
+type RateLimit struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+func (limit *RateLimit) Error() string {
+	return "rate limited:retry after " + strconv.FormatFloat(limit.RetryAfter, 'f', -1, 64) + "s"
+}
+
 type Voice struct {
 	GuildId   string
-	ChannelId string
 	Send      chan []byte
+	Events    chan *VoiceEvent
+	channelId string
 	ready     chan bool
 	state     chan *VoiceState
 	server    chan *VoiceServerUpdate
+	kick      chan bool
+	quit      chan struct{}
 	mute      bool
 	deaf      bool
+	dialer    *socket.Dialer
+	user      string
+	session   string
+	token     string
+	endpoint  string
+	live      bool
+	sending   bool
+	tries     int
 	conn      *socket.Conn
 	two       struct {
 		SSRC              uint32        `json:"ssrc"`
@@ -441,8 +605,35 @@ type Voice struct {
 		SecretKey [32]byte `json:"secret_key"`
 		Mode      string   `json:"mode"`
 	}
-	udp *net.UDPConn
-	err chan error
+	udp   *net.UDPConn
+	crypt *crypt
+	err   chan error
+	mutex *sync.Mutex
+	ssrcs map[uint32]string
+	users map[string]chan *VoicePacket
+	done  bool
+}
+
+type VoiceEvent struct {
+	Type      VoiceEventType
+	ChannelId string
+	Err       error
+}
+
+type VoiceEventType int
+
+type VoicePacket struct {
+	UserId    string
+	SSRC      uint32
+	Sequence  uint16
+	Timestamp uint32
+	Opus      []byte
+}
+
+type speaking struct {
+	UserId   string `json:"user_id"`
+	SSRC     uint32 `json:"ssrc"`
+	Speaking int    `json:"speaking"`
 }
 
 type VoiceState struct {
@@ -0,0 +1,967 @@
+package etf
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	version       = 131
+	newFloat      = 70
+	smallInt      = 97
+	integer       = 98
+	float         = 99
+	atom          = 100
+	smallTuple    = 104
+	largeTuple    = 105
+	null          = 106
+	str           = 107
+	list          = 108
+	binaryExt     = 109
+	smallBig      = 110
+	largeBig      = 111
+	smallAtom     = 115
+	mapExt        = 116
+	atomUTF8      = 118
+	smallAtomUTF8 = 119
+)
+
+const (
+	exact = 1 << 53
+)
+
+var (
+	raw       = reflect.TypeOf(json.RawMessage{})
+	unmarshal = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	text      = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	cache     = new(sync.Map)
+)
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+type fields struct {
+	exact map[string][]int
+	fold  map[string][]int
+	list  []field
+}
+
+type field struct {
+	name  string
+	index []int
+	omit  bool
+}
+
+func Unmarshal(data []byte, val interface{}) error {
+	ptr := reflect.ValueOf(val)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return errors.New("etf: unmarshal target must be a non-nil pointer")
+	}
+
+	if len(data) == 0 || data[0] != version {
+		return errors.New("etf: bad version byte")
+	}
+
+	dec := &decoder{data: data, pos: 1}
+
+	return dec.value(ptr.Elem())
+}
+
+func (dec *decoder) value(val reflect.Value) error {
+	if val.Type() == raw {
+		start := dec.pos
+
+		err := dec.skip()
+		if err != nil {
+			return err
+		}
+
+		val.SetBytes(append([]byte{version}, dec.data[start:dec.pos]...))
+		return nil
+	}
+
+	if val.Kind() == reflect.Pointer {
+		if dec.nil() {
+			val.Set(reflect.Zero(val.Type()))
+			return dec.skip()
+		}
+
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+
+		return dec.value(val.Elem())
+	}
+
+	if val.CanAddr() && val.Addr().Type().Implements(unmarshal) {
+		gen, err := dec.generic()
+		if err != nil {
+			return err
+		}
+
+		jsn, err := json.Marshal(gen)
+		if err != nil {
+			return err
+		}
+
+		return val.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(jsn)
+	}
+
+	if val.Kind() == reflect.Interface && val.NumMethod() == 0 {
+		gen, err := dec.generic()
+		if err != nil {
+			return err
+		}
+
+		if gen == nil {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+
+		val.Set(reflect.ValueOf(gen))
+		return nil
+	}
+
+	tag, err := dec.byte()
+	if err != nil {
+		return err
+	}
+
+	switch tag {
+	case smallInt, integer, smallBig, largeBig:
+		num, err := dec.integer(tag)
+		if err != nil {
+			return err
+		}
+
+		return setInteger(val, num)
+
+	case newFloat, float:
+		num, err := dec.float(tag)
+		if err != nil {
+			return err
+		}
+
+		return setFloat(val, num)
+
+	case atom, smallAtom, atomUTF8, smallAtomUTF8:
+		name, err := dec.atom(tag)
+		if err != nil {
+			return err
+		}
+
+		return setAtom(val, name)
+
+	case binaryExt:
+		byt, err := dec.binary()
+		if err != nil {
+			return err
+		}
+
+		return setBinary(val, byt)
+
+	case str:
+		byt, err := dec.str()
+		if err != nil {
+			return err
+		}
+
+		if val.Kind() == reflect.Slice && val.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(val.Type(), len(byt), len(byt))
+			for idx := range byt {
+				err := setInteger(slice.Index(idx), int64(byt[idx]))
+				if err != nil {
+					return err
+				}
+			}
+			val.Set(slice)
+			return nil
+		}
+
+		return setBinary(val, byt)
+
+	case null:
+		switch val.Kind() {
+		case reflect.Slice:
+			val.Set(reflect.MakeSlice(val.Type(), 0, 0))
+		case reflect.String:
+			val.SetString("")
+		}
+		return nil
+
+	case list, smallTuple, largeTuple:
+		var ln int
+		switch tag {
+		case list, largeTuple:
+			ln, err = dec.length(4)
+		case smallTuple:
+			ln, err = dec.length(1)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = dec.elements(val, ln)
+		if err != nil {
+			return err
+		}
+
+		if tag == list {
+			return dec.skip()
+		}
+		return nil
+
+	case mapExt:
+		ln, err := dec.length(4)
+		if err != nil {
+			return err
+		}
+
+		switch val.Kind() {
+		case reflect.Struct:
+			return dec.object(val, ln)
+		case reflect.Map:
+			return dec.dict(val, ln)
+		}
+
+		for idx := 0; idx < ln*2; idx++ {
+			err := dec.skip()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return errors.New("etf: unknown tag " + strconv.Itoa(int(tag)))
+}
+
+func (dec *decoder) elements(val reflect.Value, ln int) error {
+	switch val.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(val.Type(), ln, ln)
+		for idx := 0; idx < ln; idx++ {
+			err := dec.value(slice.Index(idx))
+			if err != nil {
+				return err
+			}
+		}
+		val.Set(slice)
+		return nil
+
+	case reflect.Array:
+		for idx := 0; idx < ln; idx++ {
+			if idx >= val.Len() {
+				err := dec.skip()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := dec.value(val.Index(idx))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for idx := 0; idx < ln; idx++ {
+		err := dec.skip()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dec *decoder) object(val reflect.Value, ln int) error {
+	set := lookup(val.Type())
+
+	for idx := 0; idx < ln; idx++ {
+		key, err := dec.key()
+		if err != nil {
+			return err
+		}
+
+		index, ok := set.exact[key]
+		if !ok {
+			index, ok = set.fold[strings.ToLower(key)]
+		}
+		if !ok {
+			err := dec.skip()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = dec.value(val.FieldByIndex(index))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dec *decoder) dict(val reflect.Value, ln int) error {
+	if val.IsNil() {
+		val.Set(reflect.MakeMapWithSize(val.Type(), ln))
+	}
+
+	for idx := 0; idx < ln; idx++ {
+		key := reflect.New(val.Type().Key()).Elem()
+
+		name, err := dec.key()
+		if err != nil {
+			return err
+		}
+
+		err = setBinary(key, []byte(name))
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(val.Type().Elem()).Elem()
+
+		err = dec.value(elem)
+		if err != nil {
+			return err
+		}
+
+		val.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func (dec *decoder) key() (string, error) {
+	gen, err := dec.generic()
+	if err != nil {
+		return "", err
+	}
+
+	switch gen := gen.(type) {
+	case string:
+		return gen, nil
+	case float64:
+		return strconv.FormatFloat(gen, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(gen), nil
+	case nil:
+		return "nil", nil
+	}
+
+	return "", errors.New("etf: unsupported map key")
+}
+
+func (dec *decoder) generic() (interface{}, error) {
+	tag, err := dec.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case smallInt, integer, smallBig, largeBig:
+		num, err := dec.integer(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		switch num := num.(type) {
+		case int64:
+			if num > -exact && num < exact {
+				return float64(num), nil
+			}
+			return strconv.FormatInt(num, 10), nil
+		case uint64:
+			if num < exact {
+				return float64(num), nil
+			}
+			return strconv.FormatUint(num, 10), nil
+		case *big.Int:
+			return num.String(), nil
+		}
+
+	case newFloat, float:
+		return dec.float(tag)
+
+	case atom, smallAtom, atomUTF8, smallAtomUTF8:
+		name, err := dec.atom(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "nil", "null":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return name, nil
+
+	case binaryExt:
+		byt, err := dec.binary()
+		if err != nil {
+			return nil, err
+		}
+		return string(byt), nil
+
+	case str:
+		byt, err := dec.str()
+		if err != nil {
+			return nil, err
+		}
+		return string(byt), nil
+
+	case null:
+		return []interface{}{}, nil
+
+	case list, smallTuple, largeTuple:
+		var ln int
+		switch tag {
+		case list, largeTuple:
+			ln, err = dec.length(4)
+		case smallTuple:
+			ln, err = dec.length(1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		elems := make([]interface{}, ln)
+		for idx := range elems {
+			elems[idx], err = dec.generic()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if tag == list {
+			err := dec.skip()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+
+	case mapExt:
+		ln, err := dec.length(4)
+		if err != nil {
+			return nil, err
+		}
+
+		dict := make(map[string]interface{}, ln)
+		for idx := 0; idx < ln; idx++ {
+			key, err := dec.key()
+			if err != nil {
+				return nil, err
+			}
+
+			dict[key], err = dec.generic()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+
+	return nil, errors.New("etf: unknown tag " + strconv.Itoa(int(tag)))
+}
+
+func (dec *decoder) skip() error {
+	tag, err := dec.byte()
+	if err != nil {
+		return err
+	}
+
+	switch tag {
+	case smallInt:
+		return dec.advance(1)
+	case integer:
+		return dec.advance(4)
+	case newFloat:
+		return dec.advance(8)
+	case float:
+		return dec.advance(31)
+	case null:
+		return nil
+	case atom, atomUTF8, str:
+		ln, err := dec.length(2)
+		if err != nil {
+			return err
+		}
+		return dec.advance(ln)
+	case smallAtom, smallAtomUTF8:
+		ln, err := dec.length(1)
+		if err != nil {
+			return err
+		}
+		return dec.advance(ln)
+	case binaryExt:
+		ln, err := dec.length(4)
+		if err != nil {
+			return err
+		}
+		return dec.advance(ln)
+	case smallBig:
+		ln, err := dec.length(1)
+		if err != nil {
+			return err
+		}
+		return dec.advance(ln + 1)
+	case largeBig:
+		ln, err := dec.length(4)
+		if err != nil {
+			return err
+		}
+		return dec.advance(ln + 1)
+	case smallTuple, largeTuple, list:
+		var ln int
+		if tag == smallTuple {
+			ln, err = dec.length(1)
+		} else {
+			ln, err = dec.length(4)
+		}
+		if err != nil {
+			return err
+		}
+
+		if tag == list {
+			ln++
+		}
+
+		for idx := 0; idx < ln; idx++ {
+			err := dec.skip()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case mapExt:
+		ln, err := dec.length(4)
+		if err != nil {
+			return err
+		}
+
+		for idx := 0; idx < ln*2; idx++ {
+			err := dec.skip()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return errors.New("etf: unknown tag " + strconv.Itoa(int(tag)))
+}
+
+func (dec *decoder) nil() bool {
+	if dec.pos >= len(dec.data) {
+		return false
+	}
+
+	var start, ln int
+	switch dec.data[dec.pos] {
+	case smallAtom, smallAtomUTF8:
+		start = dec.pos + 2
+		if start > len(dec.data) {
+			return false
+		}
+		ln = int(dec.data[dec.pos+1])
+	case atom, atomUTF8:
+		start = dec.pos + 3
+		if start > len(dec.data) {
+			return false
+		}
+		ln = int(binary.BigEndian.Uint16(dec.data[dec.pos+1:]))
+	default:
+		return false
+	}
+
+	if start+ln > len(dec.data) {
+		return false
+	}
+
+	name := string(dec.data[start : start+ln])
+
+	return name == "nil" || name == "null"
+}
+
+func (dec *decoder) byte() (byte, error) {
+	if dec.pos >= len(dec.data) {
+		return 0, errors.New("etf: unexpected end of data")
+	}
+
+	byt := dec.data[dec.pos]
+	dec.pos++
+
+	return byt, nil
+}
+
+func (dec *decoder) advance(ln int) error {
+	if ln < 0 || dec.pos+ln > len(dec.data) {
+		return errors.New("etf: unexpected end of data")
+	}
+
+	dec.pos += ln
+
+	return nil
+}
+
+func (dec *decoder) take(ln int) ([]byte, error) {
+	start := dec.pos
+
+	err := dec.advance(ln)
+	if err != nil {
+		return nil, err
+	}
+
+	return dec.data[start:dec.pos], nil
+}
+
+func (dec *decoder) length(size int) (int, error) {
+	byt, err := dec.take(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return int(byt[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(byt)), nil
+	}
+
+	return int(binary.BigEndian.Uint32(byt)), nil
+}
+
+func (dec *decoder) integer(tag byte) (interface{}, error) {
+	switch tag {
+	case smallInt:
+		byt, err := dec.byte()
+		return int64(byt), err
+
+	case integer:
+		byt, err := dec.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(byt))), nil
+	}
+
+	var ln int
+	var err error
+	if tag == smallBig {
+		ln, err = dec.length(1)
+	} else {
+		ln, err = dec.length(4)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sign, err := dec.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	digits, err := dec.take(ln)
+	if err != nil {
+		return nil, err
+	}
+
+	if ln <= 8 {
+		var num uint64
+		for idx := ln - 1; idx >= 0; idx-- {
+			num = num<<8 | uint64(digits[idx])
+		}
+
+		if sign == 0 {
+			if num <= math.MaxInt64 {
+				return int64(num), nil
+			}
+			return num, nil
+		}
+
+		if num <= 1<<63 {
+			return -int64(num-1) - 1, nil
+		}
+	}
+
+	rev := make([]byte, ln)
+	for idx := range digits {
+		rev[ln-1-idx] = digits[idx]
+	}
+
+	num := new(big.Int).SetBytes(rev)
+	if sign != 0 {
+		num.Neg(num)
+	}
+
+	return num, nil
+}
+
+func (dec *decoder) float(tag byte) (float64, error) {
+	if tag == newFloat {
+		byt, err := dec.take(8)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(byt)), nil
+	}
+
+	byt, err := dec.take(31)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(strings.TrimRight(string(byt), "\x00"), 64)
+}
+
+func (dec *decoder) atom(tag byte) (string, error) {
+	var ln int
+	var err error
+
+	switch tag {
+	case smallAtom, smallAtomUTF8:
+		ln, err = dec.length(1)
+	default:
+		ln, err = dec.length(2)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	byt, err := dec.take(ln)
+	if err != nil {
+		return "", err
+	}
+
+	return string(byt), nil
+}
+
+func (dec *decoder) binary() ([]byte, error) {
+	ln, err := dec.length(4)
+	if err != nil {
+		return nil, err
+	}
+
+	return dec.take(ln)
+}
+
+func (dec *decoder) str() ([]byte, error) {
+	ln, err := dec.length(2)
+	if err != nil {
+		return nil, err
+	}
+
+	return dec.take(ln)
+}
+
+func setInteger(val reflect.Value, num interface{}) error {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch num := num.(type) {
+		case int64:
+			val.SetInt(num)
+			return nil
+		case uint64:
+			if num <= math.MaxInt64 {
+				val.SetInt(int64(num))
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch num := num.(type) {
+		case int64:
+			if num >= 0 {
+				val.SetUint(uint64(num))
+				return nil
+			}
+		case uint64:
+			val.SetUint(num)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch num := num.(type) {
+		case int64:
+			val.SetFloat(float64(num))
+		case uint64:
+			val.SetFloat(float64(num))
+		case *big.Int:
+			flt, _ := new(big.Float).SetInt(num).Float64()
+			val.SetFloat(flt)
+		}
+		return nil
+	case reflect.String:
+		switch num := num.(type) {
+		case int64:
+			val.SetString(strconv.FormatInt(num, 10))
+		case uint64:
+			val.SetString(strconv.FormatUint(num, 10))
+		case *big.Int:
+			val.SetString(num.String())
+		}
+		return nil
+	case reflect.Bool:
+		return nil
+	}
+
+	return errors.New("etf: cannot decode integer into " + val.Type().String())
+}
+
+func setFloat(val reflect.Value, num float64) error {
+	switch val.Kind() {
+	case reflect.Float32, reflect.Float64:
+		val.SetFloat(num)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.SetInt(int64(num))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val.SetUint(uint64(num))
+		return nil
+	case reflect.String:
+		val.SetString(strconv.FormatFloat(num, 'f', -1, 64))
+		return nil
+	}
+
+	return errors.New("etf: cannot decode float into " + val.Type().String())
+}
+
+func setAtom(val reflect.Value, name string) error {
+	switch name {
+	case "nil", "null":
+		val.Set(reflect.Zero(val.Type()))
+		return nil
+	case "true", "false":
+		if val.Kind() == reflect.Bool {
+			val.SetBool(name == "true")
+			return nil
+		}
+	}
+
+	return setBinary(val, []byte(name))
+}
+
+func setBinary(val reflect.Value, byt []byte) error {
+	if val.CanAddr() && val.Addr().Type().Implements(text) {
+		return val.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(byt)
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(string(byt))
+		return nil
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			val.SetBytes(append([]byte(nil), byt...))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, err := strconv.ParseInt(string(byt), 10, 64)
+		if err != nil {
+			return err
+		}
+		val.SetInt(num)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		num, err := strconv.ParseUint(string(byt), 10, 64)
+		if err != nil {
+			return err
+		}
+		val.SetUint(num)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		num, err := strconv.ParseFloat(string(byt), 64)
+		if err != nil {
+			return err
+		}
+		val.SetFloat(num)
+		return nil
+	case reflect.Bool:
+		val.SetBool(string(byt) == "true")
+		return nil
+	}
+
+	return errors.New("etf: cannot decode binary into " + val.Type().String())
+}
+
+func lookup(typ reflect.Type) *fields {
+	if set, ok := cache.Load(typ); ok {
+		return set.(*fields)
+	}
+
+	set := &fields{
+		exact: make(map[string][]int),
+		fold:  make(map[string][]int),
+	}
+	collect(set, typ, nil)
+
+	cache.Store(typ, set)
+
+	return set
+}
+
+func collect(set *fields, typ reflect.Type, prefix []int) {
+	var embedded []reflect.StructField
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		fld := typ.Field(idx)
+		tag := fld.Tag.Get("json")
+
+		if fld.Anonymous && tag == "" && fld.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, fld)
+			continue
+		}
+		if !fld.IsExported() || tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = fld.Name
+		}
+
+		index := append(append([]int(nil), prefix...), idx)
+
+		if _, ok := set.exact[name]; ok {
+			continue
+		}
+
+		set.exact[name] = index
+		if _, ok := set.fold[strings.ToLower(name)]; !ok {
+			set.fold[strings.ToLower(name)] = index
+		}
+
+		omit := false
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				omit = true
+			}
+		}
+
+		set.list = append(set.list, field{name: name, index: index, omit: omit})
+	}
+
+	for _, fld := range embedded {
+		collect(set, fld.Type, append(append([]int(nil), prefix...), fld.Index...))
+	}
+}
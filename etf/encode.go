@@ -0,0 +1,260 @@
+package etf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	marshal = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+type encoder struct {
+	buf []byte
+}
+
+func Marshal(val interface{}) ([]byte, error) {
+	enc := &encoder{buf: []byte{version}}
+
+	err := enc.value(reflect.ValueOf(val))
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.buf, nil
+}
+
+func (enc *encoder) value(val reflect.Value) error {
+	if !val.IsValid() {
+		enc.atom("nil")
+		return nil
+	}
+
+	if val.Type() == raw {
+		return enc.raw(val.Bytes())
+	}
+
+	if val.Type().Implements(marshal) && (val.Kind() != reflect.Pointer || !val.IsNil()) {
+		jsn, err := val.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		return enc.raw(jsn)
+	}
+
+	switch val.Kind() {
+	case reflect.Bool:
+		enc.atom(strconv.FormatBool(val.Bool()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc.int(val.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		enc.uint(val.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		enc.buf = append(enc.buf, newFloat)
+		enc.buf = binary.BigEndian.AppendUint64(enc.buf, math.Float64bits(val.Float()))
+
+	case reflect.String:
+		enc.binary([]byte(val.String()))
+
+	case reflect.Slice:
+		if val.IsNil() {
+			enc.atom("nil")
+			return nil
+		}
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			enc.binary(val.Bytes())
+			return nil
+		}
+		return enc.list(val)
+
+	case reflect.Array:
+		return enc.list(val)
+
+	case reflect.Map:
+		if val.IsNil() {
+			enc.atom("nil")
+			return nil
+		}
+		return enc.dict(val)
+
+	case reflect.Struct:
+		return enc.object(val)
+
+	case reflect.Pointer, reflect.Interface:
+		if val.IsNil() {
+			enc.atom("nil")
+			return nil
+		}
+		return enc.value(val.Elem())
+
+	default:
+		return errors.New("etf: cannot encode " + val.Type().String())
+	}
+
+	return nil
+}
+
+func (enc *encoder) raw(byt []byte) error {
+	if len(byt) == 0 {
+		enc.atom("nil")
+		return nil
+	}
+
+	if byt[0] == version {
+		enc.buf = append(enc.buf, byt[1:]...)
+		return nil
+	}
+
+	var gen interface{}
+
+	err := json.Unmarshal(byt, &gen)
+	if err != nil {
+		return err
+	}
+
+	return enc.value(reflect.ValueOf(gen))
+}
+
+func (enc *encoder) list(val reflect.Value) error {
+	if val.Len() == 0 {
+		enc.buf = append(enc.buf, null)
+		return nil
+	}
+
+	enc.buf = append(enc.buf, list)
+	enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(val.Len()))
+
+	for idx := 0; idx < val.Len(); idx++ {
+		err := enc.value(val.Index(idx))
+		if err != nil {
+			return err
+		}
+	}
+
+	enc.buf = append(enc.buf, null)
+
+	return nil
+}
+
+func (enc *encoder) dict(val reflect.Value) error {
+	keys := val.MapKeys()
+
+	names := make([]string, len(keys))
+	for idx, key := range keys {
+		switch key.Kind() {
+		case reflect.String:
+			names[idx] = key.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			names[idx] = strconv.FormatInt(key.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			names[idx] = strconv.FormatUint(key.Uint(), 10)
+		default:
+			return errors.New("etf: unsupported map key " + key.Type().String())
+		}
+	}
+
+	order := make([]int, len(keys))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.Slice(order, func(a, b int) bool { return names[order[a]] < names[order[b]] })
+
+	enc.buf = append(enc.buf, mapExt)
+	enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(len(keys)))
+
+	for _, idx := range order {
+		enc.binary([]byte(names[idx]))
+
+		err := enc.value(val.MapIndex(keys[idx]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (enc *encoder) object(val reflect.Value) error {
+	set := lookup(val.Type())
+
+	list := make([]reflect.Value, 0, len(set.list))
+	names := make([]string, 0, len(set.list))
+
+	for _, fld := range set.list {
+		elem := val.FieldByIndex(fld.index)
+		if fld.omit && elem.IsZero() {
+			continue
+		}
+
+		list = append(list, elem)
+		names = append(names, fld.name)
+	}
+
+	enc.buf = append(enc.buf, mapExt)
+	enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(len(list)))
+
+	for idx := range list {
+		enc.binary([]byte(names[idx]))
+
+		err := enc.value(list[idx])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (enc *encoder) atom(name string) {
+	enc.buf = append(enc.buf, smallAtomUTF8, byte(len(name)))
+	enc.buf = append(enc.buf, name...)
+}
+
+func (enc *encoder) binary(byt []byte) {
+	enc.buf = append(enc.buf, binaryExt)
+	enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(len(byt)))
+	enc.buf = append(enc.buf, byt...)
+}
+
+func (enc *encoder) int(num int64) {
+	switch {
+	case num >= 0 && num <= math.MaxUint8:
+		enc.buf = append(enc.buf, smallInt, byte(num))
+	case num >= math.MinInt32 && num <= math.MaxInt32:
+		enc.buf = append(enc.buf, integer)
+		enc.buf = binary.BigEndian.AppendUint32(enc.buf, uint32(int32(num)))
+	case num < 0:
+		enc.big(uint64(-(num+1))+1, 1)
+	default:
+		enc.big(uint64(num), 0)
+	}
+}
+
+func (enc *encoder) uint(num uint64) {
+	if num <= math.MaxInt32 {
+		enc.int(int64(num))
+		return
+	}
+
+	enc.big(num, 0)
+}
+
+func (enc *encoder) big(num uint64, sign byte) {
+	var digits []byte
+	for num > 0 {
+		digits = append(digits, byte(num))
+		num >>= 8
+	}
+
+	enc.buf = append(enc.buf, smallBig, byte(len(digits)), sign)
+	enc.buf = append(enc.buf, digits...)
+}
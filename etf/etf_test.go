@@ -0,0 +1,246 @@
+package etf
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type member struct {
+	UserId   string          `json:"user_id"`
+	Nick     *string         `json:"nick"`
+	Roles    []string        `json:"roles"`
+	Flags    uint64          `json:"flags"`
+	Deaf     bool            `json:"deaf"`
+	Position int             `json:"position,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func TestMarshalGolden(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want []byte
+	}{
+		{1, []byte{131, 97, 1}},
+		{-1, []byte{131, 98, 0xff, 0xff, 0xff, 0xff}},
+		{uint64(1) << 40, []byte{131, 110, 6, 0, 0, 0, 0, 0, 0, 1}},
+		{int64(math.MinInt64), []byte{131, 110, 8, 1, 0, 0, 0, 0, 0, 0, 0, 0x80}},
+		{uint64(math.MaxUint64), []byte{131, 110, 8, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{nil, []byte{131, 119, 3, 'n', 'i', 'l'}},
+		{true, []byte{131, 119, 4, 't', 'r', 'u', 'e'}},
+		{"a", []byte{131, 109, 0, 0, 0, 1, 'a'}},
+		{[]int{}, []byte{131, 106}},
+		{[]int(nil), []byte{131, 119, 3, 'n', 'i', 'l'}},
+		{[]int{1, 2}, []byte{131, 108, 0, 0, 0, 2, 97, 1, 97, 2, 106}},
+		{map[string]int{"b": 2, "a": 1}, []byte{131, 116, 0, 0, 0, 2, 109, 0, 0, 0, 1, 'a', 97, 1, 109, 0, 0, 0, 1, 'b', 97, 2}},
+		{json.RawMessage(`{"a":null}`), []byte{131, 116, 0, 0, 0, 1, 109, 0, 0, 0, 1, 'a', 119, 3, 'n', 'i', 'l'}},
+		{json.RawMessage{131, 97, 7}, []byte{131, 97, 7}},
+	}
+
+	for _, test := range tests {
+		got, err := Marshal(test.val)
+		if err != nil {
+			t.Errorf("%#v: %v", test.val, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%#v: got %v want %v", test.val, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalBig(t *testing.T) {
+	small := []byte{131, 110, 8, 0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x10}
+
+	var id string
+	if err := Unmarshal(small, &id); err != nil || id != "1170935903116328960" {
+		t.Errorf("small_big string: got %q %v", id, err)
+	}
+
+	var num uint64
+	if err := Unmarshal(small, &num); err != nil || num != 1170935903116328960 {
+		t.Errorf("small_big uint64: got %d %v", num, err)
+	}
+
+	var gen interface{}
+	if err := Unmarshal(small, &gen); err != nil || gen != "1170935903116328960" {
+		t.Errorf("small_big generic: got %#v %v", gen, err)
+	}
+
+	if err := Unmarshal([]byte{131, 110, 2, 1, 0x01, 0x01}, &gen); err != nil || gen != float64(-257) {
+		t.Errorf("small_big negative: got %#v %v", gen, err)
+	}
+
+	large := []byte{131, 111, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	if err := Unmarshal(large, &id); err != nil || id != "18446744073709551616" {
+		t.Errorf("large_big string: got %q %v", id, err)
+	}
+	if err := Unmarshal(large, &gen); err != nil || gen != "18446744073709551616" {
+		t.Errorf("large_big generic: got %#v %v", gen, err)
+	}
+	if err := Unmarshal(large, &num); err == nil {
+		t.Errorf("large_big uint64: expected overflow error, got %d", num)
+	}
+}
+
+func TestUnmarshalAtoms(t *testing.T) {
+	for _, name := range []string{"nil", "null"} {
+		data := append([]byte{131, 119, byte(len(name))}, name...)
+
+		nick := new(string)
+		if err := Unmarshal(data, &nick); err != nil || nick != nil {
+			t.Errorf("%s pointer: got %v %v", name, nick, err)
+		}
+
+		gen := interface{}("x")
+		if err := Unmarshal(data, &gen); err != nil || gen != nil {
+			t.Errorf("%s generic: got %#v %v", name, gen, err)
+		}
+
+		str := "x"
+		if err := Unmarshal(data, &str); err != nil || str != "" {
+			t.Errorf("%s string: got %q %v", name, str, err)
+		}
+	}
+
+	var ok bool
+	if err := Unmarshal([]byte{131, 100, 0, 4, 't', 'r', 'u', 'e'}, &ok); err != nil || !ok {
+		t.Errorf("atom true: got %v %v", ok, err)
+	}
+}
+
+func TestUnmarshalLists(t *testing.T) {
+	improper := []byte{131, 108, 0, 0, 0, 2, 97, 1, 97, 2, 97, 3}
+
+	var nums []int
+	if err := Unmarshal(improper, &nums); err != nil || !reflect.DeepEqual(nums, []int{1, 2}) {
+		t.Errorf("improper list: got %v %v", nums, err)
+	}
+
+	var gen interface{}
+	if err := Unmarshal(improper, &gen); err != nil || !reflect.DeepEqual(gen, []interface{}{float64(1), float64(2)}) {
+		t.Errorf("improper generic: got %#v %v", gen, err)
+	}
+
+	nums = nil
+	if err := Unmarshal([]byte{131, 106}, &nums); err != nil || nums == nil || len(nums) != 0 {
+		t.Errorf("empty list: got %#v %v", nums, err)
+	}
+	if err := Unmarshal([]byte{131, 106}, &gen); err != nil || !reflect.DeepEqual(gen, []interface{}{}) {
+		t.Errorf("empty generic: got %#v %v", gen, err)
+	}
+
+	if err := Unmarshal([]byte{131, 107, 0, 3, 1, 2, 3}, &nums); err != nil || !reflect.DeepEqual(nums, []int{1, 2, 3}) {
+		t.Errorf("string ext: got %v %v", nums, err)
+	}
+
+	var pair [2]string
+	tuple := []byte{131, 104, 3, 109, 0, 0, 0, 1, 'a', 109, 0, 0, 0, 1, 'b', 109, 0, 0, 0, 1, 'c'}
+	if err := Unmarshal(tuple, &pair); err != nil || pair != [2]string{"a", "b"} {
+		t.Errorf("tuple: got %v %v", pair, err)
+	}
+}
+
+func TestUnmarshalKeys(t *testing.T) {
+	data := []byte{131, 116, 0, 0, 0, 3,
+		119, 7, 'U', 'S', 'E', 'R', '_', 'I', 'D', 109, 0, 0, 0, 2, '4', '2',
+		109, 0, 0, 0, 4, 'D', 'e', 'a', 'f', 119, 4, 't', 'r', 'u', 'e',
+		109, 0, 0, 0, 7, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 108, 0, 0, 0, 1, 97, 1, 106,
+	}
+
+	var mem member
+	if err := Unmarshal(data, &mem); err != nil {
+		t.Fatal(err)
+	}
+	if mem.UserId != "42" || !mem.Deaf {
+		t.Errorf("got %+v", mem)
+	}
+
+	var dict map[string]interface{}
+	if err := Unmarshal([]byte{131, 116, 0, 0, 0, 2, 97, 1, 119, 4, 't', 'r', 'u', 'e', 119, 3, 'n', 'i', 'l', 97, 2}, &dict); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dict, map[string]interface{}{"1": true, "nil": float64(2)}) {
+		t.Errorf("got %#v", dict)
+	}
+}
+
+func TestRawPassthrough(t *testing.T) {
+	inner := []byte{116, 0, 0, 0, 1, 109, 0, 0, 0, 2, 'i', 'd', 110, 8, 0, 0, 0, 0, 0, 0, 0, 0x40, 0x10}
+	data := append([]byte{131, 116, 0, 0, 0, 1, 109, 0, 0, 0, 4, 'd', 'a', 't', 'a'}, inner...)
+
+	var mem member
+	if err := Unmarshal(data, &mem); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mem.Data, append([]byte{131}, inner...)) {
+		t.Fatalf("got %v", []byte(mem.Data))
+	}
+
+	var val struct {
+		Id string `json:"id"`
+	}
+	if err := Unmarshal(mem.Data, &val); err != nil || val.Id != "1170935903116328960" {
+		t.Errorf("got %+v %v", val, err)
+	}
+
+	out, err := Marshal(struct {
+		Data json.RawMessage `json:"data"`
+	}{mem.Data})
+	if err != nil || !bytes.Equal(out, data) {
+		t.Errorf("got %v %v", out, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	nick := "zunda"
+	in := member{
+		UserId: "1170935903116328960",
+		Nick:   &nick,
+		Roles:  []string{"1", "2"},
+		Flags:  math.MaxUint64,
+		Deaf:   true,
+		Data:   json.RawMessage{131, 97, 5},
+	}
+
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out member
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v want %+v", out, in)
+	}
+
+	in.Nick, in.Roles = nil, []string{}
+	data, err = Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = member{Nick: &nick}
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v want %+v", out, in)
+	}
+
+	for _, num := range []int64{0, 255, 256, -256, math.MaxInt32, math.MinInt32, math.MaxInt32 + 1, math.MinInt32 - 1, math.MaxInt64, math.MinInt64} {
+		data, err := Marshal(num)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got int64
+		if err := Unmarshal(data, &got); err != nil || got != num {
+			t.Errorf("%d: got %d %v", num, got, err)
+		}
+	}
+}
@@ -32,10 +32,14 @@ type vc struct {
 	voice     *discord.Voice
 	mutex     *sync.Mutex
 	dict      []string
+	words     *sync.Mutex
+	lock      *sync.Mutex
+	queue     map[string]*discord.Message
 }
 
 const (
 	host  = "https://api.su-shiki.com/v2/voicevox/audio/"
+	index = "https://api.su-shiki.com/v2/voicevox/speakers/"
 	green = 0xa4d5ad
 )
 
@@ -54,7 +58,8 @@ var (
 			IdleConnTimeout:     time.Second * 10,
 		},
 	}
-	choises = []discord.Choice{
+	speakers []discord.Choice
+	choises  = []discord.Choice{
 		{
 			Name:  "ずんだもん: ノーマル",
 			Value: "3",
@@ -150,6 +155,12 @@ func main() {
 
 	voicevox := os.Getenv("VOICEVOX")
 
+	speakers, err = fetch(voicevox)
+	if err != nil {
+		fmt.Println(err)
+		speakers = choises
+	}
+
 	db := &redis.DB{
 		URI:  os.Getenv("REDISURI"),
 		Pass: os.Getenv("REDISPASS"),
@@ -186,6 +197,8 @@ func main() {
 	sess := discord.New(discord.Guilds | discord.GuildMessages | discord.MessageContent | discord.GuildVoiceStates)
 
 	sess.Cached = true
+	sess.Compress = true
+	sess.ETF = true
 
 	sess.Presence = discord.Presence{
 		Status: discord.Online,
@@ -196,491 +209,441 @@ func main() {
 		},
 	}
 
-	sess.Listeners = discord.Listeners{
-		Ready: func(bot *discord.Bot) {
-			fmt.Println(bot.Username + "#" + bot.Discriminator)
-		},
-		InteractionCreate: func(bot *discord.Bot, interaction *discord.Interaction) {
-			switch interaction.Type {
-			case discord.Ping:
-			case discord.ApplicationCommand:
-				switch interaction.Data.Name {
-
-				case "help":
-
-					resp := &discord.Response{
-						Content: ":question: ヘルプメニュー",
-						Embeds: []discord.Embed{{Description: "/help - このメニューを表示\n" +
-							"/ping - ping値を表示\n" +
-							"/join - 読み上げを開始\n" +
-							"/leave - 読み上げを終了\n" +
-							"/switch - キャラクターを変更\n" +
-							"/dict - 辞書を変更\n" +
-							"/export - 辞書を出力", Color: green}},
-					}
-					interaction.Reply(resp)
-
-				case "ping":
-
-					resp := &discord.Response{
-						Content: ":timer: レイテンシ",
-						Embeds:  []discord.Embed{{Description: strconv.FormatInt(bot.Latency, 10) + "ms", Color: green}},
-					}
-					interaction.Reply(resp)
-
-				case "join":
-
-					err := interaction.Defer(false)
-					if err != nil {
-						return
-					}
-
-					var ok bool
-					var voice *discord.Voice
-					for _, state := range interaction.Guild.VoiceStates {
-						if state.UserID == interaction.Author.User.Id {
-							voice, err = sess.Connect(interaction.GuildId, state.ChannelID, false, true)
-							ok = err == nil
-							break
-						}
-					}
-
-					if !ok {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "ボイスチャンネルに接続できなかったのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+	swap := func(interaction *discord.Interaction, val string) {
+		var name string
+		for _, speaker := range speakers {
+			if speaker.Value.(string) == val {
+				name = speaker.Name
+				break
+			}
+		}
 
-					dict := make([]string, 0)
-					opn, err := os.Open(filepath.Join("dict", interaction.GuildId+".dict"))
-					if err == nil {
-						defer opn.Close()
-						err := gob.NewDecoder(opn).Decode(&dict)
-						if err != nil {
-							resp := &discord.Response{
-								Content: ":red_circle: 失敗...",
-								Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
-							}
-							interaction.Edit(resp)
-							return
-						}
-					}
+		if name == "" {
+			resp := &discord.Response{
+				Content: ":red_circle: 失敗...",
+				Embeds:  []discord.Embed{{Description: "データが無効な可能性があるのだ", Color: green}},
+			}
+			interaction.Edit(resp)
+			return
+		}
 
-					vc := &vc{interaction.ChannelId, voice, new(sync.Mutex), dict}
-					vcs.Store(interaction.GuildId, vc)
+		err := db.Send("SET", interaction.Author.User.Id, val)
+		if err != nil {
+			resp := &discord.Response{
+				Content: ":red_circle: 失敗...",
+				Embeds:  []discord.Embed{{Description: "データの保存に失敗したのだ", Color: green}},
+			}
+			interaction.Edit(resp)
+			return
+		}
 
-					resp := &discord.Response{
-						Content: ":green_circle: 成功!",
-						Embeds:  []discord.Embed{{Description: "ボイスチャンネルに接続したのだ", Color: green}},
-					}
-					interaction.Edit(resp)
+		res := db.Receive()
+		if _, ok := res.(error); ok {
+			resp := &discord.Response{
+				Content: ":red_circle: 失敗...",
+				Embeds:  []discord.Embed{{Description: "データの保存に失敗したのだ", Color: green}},
+			}
+			interaction.Edit(resp)
+			return
+		}
 
-					time.Sleep(time.Second)
+		resp := &discord.Response{
+			Content: ":green_circle: 成功!",
+			Embeds:  []discord.Embed{{Description: name + "に設定したのだ", Color: green}},
+		}
+		interaction.Edit(resp)
+	}
 
-					opn, err = os.Open("greet.dca")
-					if err != nil {
-						return
-					}
-					defer opn.Close()
+	status := func() {
+		count := 0
+		vcs.Range(func(key, value any) bool {
+			count++
+			return true
+		})
 
-					voice.Speak(true)
-					defer voice.Speak(false)
+		pres := sess.CurrentPresence()
+		pres.Activities = []discord.Activity{{
+			Type:  discord.Custom,
+			State: strconv.Itoa(count) + "サーバーで読み上げ中なのだ",
+		}}
 
-					var ln int16
-					for {
-						err := binary.Read(opn, binary.LittleEndian, &ln)
-						if err != nil {
-							return
-						}
+		err := sess.SetPresence(pres)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 
-						buf := make([]byte, ln)
-						err = binary.Read(opn, binary.LittleEndian, &buf)
-						if err != nil {
-							return
-						}
+	read := func(msg *discord.Message) {
+		if msg.Author.Bot || msg.Author.System {
+			return
+		}
 
-						voice.Send <- buf
-					}
+		any, ok := vcs.Load(msg.GuildId)
+		if !ok {
+			return
+		}
 
-				case "leave":
+		vc := any.(*vc)
+		if vc.channelId != msg.ChannelId {
+			return
+		}
 
-					err := interaction.Defer(false)
-					if err != nil {
-						return
-					}
+		vc.enqueue(msg)
+		defer vc.dequeue(msg)
 
-					any, ok := vcs.Load(interaction.GuildId)
-					if !ok {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "ボイスチャンネルが見つからなかったのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		vc.mutex.Lock()
+		defer vc.mutex.Unlock()
 
-					vc := any.(*vc)
+		if !vc.current(msg) {
+			return
+		}
 
-					err = sess.Disconnect(interaction.GuildId)
-					if err != nil {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "ボイスチャンネルから切断できなかったのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		con := msg.Content
 
-					vcs.Delete(interaction.GuildId)
+		if !utf8.ValidString(con) {
+			return
+		}
 
-					resp := &discord.Response{
-						Content: ":green_circle: 成功!",
-						Embeds:  []discord.Embed{{Description: "ボイスチャンネルから切断したのだ", Color: green}},
-					}
-					interaction.Edit(resp)
+		if len([]rune(con)) >= 60 {
+			con = string([]rune(con[:60])) + " 以下略"
+		}
+		con += " "
 
-					if len(vc.dict) == 0 {
-						return
-					}
+		words := []string{"\n", " "}
 
-					if crt, _ := os.Create(filepath.Join("dict", vc.voice.GuildId+".dict")); crt != nil {
-						defer crt.Close()
-						gob.NewEncoder(crt).Encode(vc.dict)
-					}
+		missing := make([]string, 0, len(msg.Mentions))
+		for _, mention := range msg.Mentions {
+			if _, ok := discord.Global.Member(msg.GuildId, mention.Id); !ok {
+				missing = append(missing, mention.Id)
+			}
+		}
 
-				case "dict":
+		if len(missing) > 0 {
+			sess.RequestMembers(msg.GuildId, "", missing)
+		}
 
-					err := interaction.Defer(false)
-					if err != nil {
-						return
-					}
+		for _, mention := range msg.Mentions {
+			name := mention.Username
+			if member, ok := discord.Global.Member(msg.GuildId, mention.Id); ok && member.Nickname != "" {
+				name = member.Nickname
+			}
+			words = append(words, "<@"+mention.Id+">", name, "<@!"+mention.Id+">", name)
+		}
 
-					any, ok := vcs.Load(interaction.GuildId)
-					if !ok {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "ボイスチャンネルが見つからなかったのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		for _, mention := range msg.RoleMentions {
+			if role, ok := discord.Global.Role(msg.GuildId, mention); ok && role.Mentionable {
+				words = append(words, "<@&"+role.Id+">", role.Name)
+			}
+			words = append(words, "<@&"+mention+">", "メンション省略")
+		}
 
-					vc := any.(*vc)
+		var prev int
+		for idx, curr := range []rune(con) {
+			low := unicode.ToLower(curr)
+			if 'a' > low || 'z' < low {
+				if idx <= prev {
+					continue
+				}
+				word := string([]rune(con)[prev:idx])
+				if any, ok := def.Load(strings.ToLower(word)); ok {
+					words = append(words, word, any.(string))
+				}
+				prev = idx
+			}
+		}
 
-					var old string
-					var nw string
-					for _, option := range interaction.Data.Options {
-						if option.Name == "old" {
-							old = option.Value.(string)
-						} else {
-							nw = option.Value.(string)
-						}
-					}
+		con = strings.NewReplacer(vc.snapshot()...).Replace(con)
+		con = strings.NewReplacer(words...).Replace(con)
 
-					vc.dict = append(vc.dict, old, nw)
+		con = emojis.ReplaceAllString(con, "")
+		con = links.ReplaceAllString(con, "")
+		con = channels.ReplaceAllStringFunc(con, func(mention string) string {
+			if channel, ok := discord.Global.Channel(mention[2 : len(mention)-1]); ok {
+				return channel.Name
+			}
+			return "メンション省略"
+		})
 
-					resp := &discord.Response{
-						Content: ":green_circle: 成功!",
-						Embeds:  []discord.Embed{{Description: old + "を" + nw + "として保存したのだ", Color: green}},
-					}
-					interaction.Edit(resp)
+		if len(con) == 0 {
+			return
+		}
 
-				case "switch":
+		err := db.Send("GET", msg.Author.Id)
+		if err != nil {
+			return
+		}
 
-					err := interaction.Defer(true)
-					if err != nil {
-						return
-					}
+		res := db.Receive()
 
-					val := interaction.Data.Options[0].Value.(string)
-					i32, err := strconv.Atoi(val)
-					if err != nil || i32 > 20 || i32 < 0 {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "データが無効な可能性があるのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		var speaker string
+		switch res := res.(type) {
+		case []byte:
+			speaker = string(res)
+		case error:
+			if !errors.Is(res, redis.Nil) {
+				return
+			}
+			speaker = "3"
+		default:
+			return
+		}
 
-					err = db.Send("SET", interaction.Author.User.Id, val)
-					if err != nil {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "データの保存に失敗したのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		url := host + "?key=" + voicevox + "&speaker=" + speaker + "&text=" + url.QueryEscape(con)
+		get, err := client.Get(url)
+		if err != nil {
+			return
+		}
 
-					res := db.Receive()
-					if _, ok := res.(error); ok {
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "データの保存に失敗したのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		defer get.Body.Close()
+		defer io.Copy(io.Discard, get.Body)
+		if get.StatusCode != http.StatusOK {
+			return
+		}
 
-					for _, choise := range choises {
-						if choise.Value.(string) == val {
-							resp := &discord.Response{
-								Content: ":green_circle: 成功!",
-								Embeds:  []discord.Embed{{Description: choise.Name + "に設定したのだ", Color: green}},
-							}
-							interaction.Edit(resp)
-							break
-						}
-					}
+		buf := bufio.NewReader(get.Body)
 
-				case "export":
+		cmd, err := ffmpeg.New(buf)
+		if err != nil {
+			return
+		}
 
-					err := interaction.Defer(true)
-					if err != nil {
-						return
-					}
+		vc.voice.Speak(true)
+		defer vc.voice.Speak(false)
 
-					opn, err := os.Open(filepath.Join("dict", interaction.GuildId+".dict"))
-					if err != nil {
-						defer opn.Close()
-						resp := &discord.Response{
-							Content: ":red_circle: 失敗...",
-							Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
-						}
-						interaction.Edit(resp)
-						return
-					}
+		out, err := cmd.Run()
+		if err != nil {
+			return
+		}
+		defer cmd.Process.Kill()
 
-					var byt []byte
-					var ext string
-					switch interaction.Data.Options[0].Value.(string) {
-					case "gob":
-
-						buf := new(bytes.Buffer)
-						_, err := io.Copy(buf, opn)
-						if err != nil {
-							resp := &discord.Response{
-								Content: ":red_circle: 失敗...",
-								Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
-							}
-							interaction.Edit(resp)
-							return
-						}
-						byt, ext = buf.Bytes(), ".dict"
-
-					case "json":
-
-						dict := make([]string, 0)
-						err := gob.NewDecoder(opn).Decode(&dict)
-						if err != nil {
-							resp := &discord.Response{
-								Content: ":red_circle: 失敗...",
-								Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
-							}
-							interaction.Edit(resp)
-							return
-						}
+		dec := ogg.New(out)
+		for {
+			byt, err := dec.Decode()
+			if err != nil || !vc.current(msg) {
+				break
+			}
 
-						byt, err = json.MarshalIndent(dict, "", "  ")
-						if err != nil {
-							resp := &discord.Response{
-								Content: ":red_circle: 失敗...",
-								Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
-							}
-							interaction.Edit(resp)
-						}
-						ext = ".json"
-					}
+			select {
+			case vc.voice.Send <- byt:
+			case <-vc.voice.Done():
+				return
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}
 
-					resp := &discord.Response{
-						Content: ":green_circle: 成功!",
-						Embeds:  []discord.Embed{{Description: "ファイルを添付したのだ", Color: green}},
-						Files:   []discord.File{{Name: interaction.GuildId + ext, Content: byt}},
-					}
-					interaction.Edit(resp)
+	sess.Listeners = discord.Listeners{
+		Ready: func(bot *discord.Bot) {
+			fmt.Println(bot.Username + "#" + bot.Discriminator)
+			status()
+		},
+		Disconnect: func(bot *discord.Bot, err error) {
+			fmt.Println("disconnected:", err)
+		},
+		Error: func(bot *discord.Bot, err error) {
+			fmt.Println(err)
+		},
+		Reconnect: func(bot *discord.Bot) {
+			fmt.Println("reconnected")
 
+			vcs.Range(func(key, value any) bool {
+				resp := &discord.Response{
+					Content: ":arrows_counterclockwise: 再接続",
+					Embeds:  []discord.Embed{{Description: "接続が切れていたので再接続したのだ", Color: green}},
 				}
-			}
+				sess.SendMessage(value.(*vc).channelId, resp)
+				return true
+			})
 		},
-
 		MessageCreate: func(bot *discord.Bot, msg *discord.Message) {
-
-			if msg.Author.Bot || msg.Author.System {
-				return
-			}
-
+			read(msg)
+		},
+		MessageUpdate: func(bot *discord.Bot, msg *discord.Message) {
 			any, ok := vcs.Load(msg.GuildId)
 			if !ok {
 				return
 			}
 
-			vc := any.(*vc)
-			if vc.channelId != msg.ChannelId {
+			if any.(*vc).edited(msg) {
+				read(msg)
+			}
+		},
+		MessageDelete: func(bot *discord.Bot, msg *discord.MessageDelete) {
+			any, ok := vcs.Load(msg.GuildId)
+			if !ok {
 				return
 			}
 
-			vc.mutex.Lock()
-			defer vc.mutex.Unlock()
+			any.(*vc).cancel(msg.Id)
+		},
 
-			con := msg.Content
+		VoiceStateUpdate: func(bot *discord.Bot, voiceStates []discord.VoiceState) {
 
-			if !utf8.ValidString(con) {
+			if len(voiceStates) == 0 {
 				return
 			}
 
-			if len([]rune(con)) >= 60 {
-				con = string([]rune(con[:60])) + " 以下略"
+			any, ok := vcs.Load(voiceStates[0].GuildID)
+			if !ok {
+				return
 			}
-			con += " "
 
-			words := []string{"\n", " "}
-
-			for _, mention := range msg.Mentions {
-				words = append(words, "<@"+mention.Id+">", mention.Username, "<@!"+mention.Id+">", mention.Username)
-			}
+			vc := any.(*vc)
 
-			if guild, ok := discord.Global.Guilds[msg.GuildId]; ok {
-				for _, mention := range msg.RoleMentions {
-					for _, role := range guild.Roles {
-						if role.Id == mention && role.Mentionable {
-							words = append(words, "<@&"+role.Id+">", role.Name)
-							break
-						}
-					}
-					words = append(words, "<@&"+mention+">", "メンション省略")
+			for _, state := range voiceStates {
+				if vc.voice.ChannelId() != state.ChannelID || state.Member.User.Bot {
+					continue
 				}
+				ok = false
+				break
 			}
 
-			var prev int
-			for idx, curr := range []rune(con) {
-				low := unicode.ToLower(curr)
-				if 'a' > low || 'z' < low {
-					if idx <= prev {
-						continue
-					}
-					word := string([]rune(con)[prev:idx])
-					if any, ok := def.Load(strings.ToLower(word)); ok {
-						words = append(words, word, any.(string))
-					}
-					prev = idx
+			if ok {
+				err := sess.Disconnect(vc.voice.GuildId)
+				if err != nil {
+					return
 				}
-			}
-
-			con = strings.NewReplacer(vc.dict...).Replace(con)
-			con = strings.NewReplacer(words...).Replace(con)
 
-			con = emojis.ReplaceAllString(con, "")
-			con = links.ReplaceAllString(con, "")
-			con = channels.ReplaceAllStringFunc(con, func(mention string) string {
-				if channel, ok := discord.Global.Channels[mention[2:len(mention)-1]]; ok {
-					return channel.Name
-				}
-				return "メンション省略"
-			})
+				vcs.Delete(vc.voice.GuildId)
+				status()
 
-			if len(con) == 0 {
-				return
+				vc.save(vc.voice.GuildId)
 			}
+		},
+	}
 
-			err := db.Send("GET", msg.Author.Id)
-			if err != nil {
+	sess.Components = map[string]func(bot *discord.Bot, interaction *discord.Interaction){
+		"switch": func(bot *discord.Bot, interaction *discord.Interaction) {
+			if len(interaction.Data.Values) == 0 {
 				return
 			}
 
-			res := db.Receive()
+			swap(interaction, interaction.Data.Values[0])
+		},
 
-			var speaker string
-			switch res := res.(type) {
-			case []byte:
-				speaker = string(res)
-			case error:
-				if !errors.Is(res, redis.Nil) {
-					return
+		"dict": func(bot *discord.Bot, interaction *discord.Interaction) {
+
+			any, ok := vcs.Load(interaction.GuildId)
+			if !ok {
+				resp := &discord.Response{
+					Content: ":red_circle: 失敗...",
+					Embeds:  []discord.Embed{{Description: "ボイスチャンネルが見つからなかったのだ", Color: green}},
 				}
-				speaker = "3"
-			default:
+				interaction.Edit(resp)
 				return
 			}
 
-			url := host + "?key=" + voicevox + "&speaker=" + speaker + "&text=" + url.QueryEscape(con)
-			get, err := client.Get(url)
-			if err != nil {
+			vc := any.(*vc)
+
+			spl := strings.SplitN(interaction.Data.CustomId, ":", 3)
+			if len(spl) < 2 {
 				return
 			}
 
-			defer get.Body.Close()
-			defer io.Copy(io.Discard, get.Body)
-			if get.StatusCode != http.StatusOK {
-				return
-			}
-
-			buf := bufio.NewReader(get.Body)
-
-			cmd, err := ffmpeg.New(buf)
-			if err != nil {
-				return
-			}
-
-			vc.voice.Speak(true)
-			defer vc.voice.Speak(false)
-
-			out, err := cmd.Run()
-			if err != nil {
-				return
+			key := ""
+			if len(spl) > 2 {
+				key = spl[2]
+			} else if len(interaction.Data.Values) > 0 {
+				key = interaction.Data.Values[0]
 			}
-			defer cmd.Process.Kill()
 
-			dec := ogg.New(out)
-			for {
-				byt, err := dec.Decode()
-				if err != nil {
-					break
+			missing := func() {
+				resp := &discord.Response{
+					Content: ":red_circle: 失敗...",
+					Embeds:  []discord.Embed{{Description: "単語が見つからなかったのだ", Color: green}},
 				}
-				vc.voice.Send <- byt
+				interaction.Edit(resp)
 			}
-		},
 
-		VoiceStateUpdate: func(bot *discord.Bot, voiceStates []discord.VoiceState) {
-
-			if len(voiceStates) == 0 {
-				return
-			}
-
-			any, ok := vcs.Load(voiceStates[0].GuildID)
+			old, nw, ok := vc.word(key)
 			if !ok {
+				missing()
 				return
 			}
 
-			vc := any.(*vc)
+			switch spl[1] {
+			case "select":
 
-			for _, state := range voiceStates {
-				if vc.voice.ChannelId != state.ChannelID || state.Member.User.Bot {
-					continue
+				resp := &discord.Response{
+					Content: ":book: ユーザー辞書",
+					Embeds:  []discord.Embed{{Description: old + " → " + nw, Color: green}},
+					Components: []discord.Row{{Components: []discord.Component{
+						{
+							Type:     discord.ButtonComponent,
+							CustomId: "dict:edit:" + key,
+							Style:    discord.PrimaryButton,
+							Label:    "編集",
+						}, {
+							Type:     discord.ButtonComponent,
+							CustomId: "dict:delete:" + key,
+							Style:    discord.DangerButton,
+							Label:    "削除",
+						},
+					}}},
 				}
-				ok = false
-				break
-			}
+				interaction.Edit(resp)
+
+			case "edit":
+
+				modal := &discord.Modal{
+					CustomId: "dict:modal:" + key,
+					Title:    "辞書を編集",
+					Components: []discord.Row{
+						{Components: []discord.Component{{
+							Type:      discord.TextInputComponent,
+							CustomId:  "old",
+							Style:     discord.ShortInput,
+							Label:     "置き換える単語",
+							Value:     old,
+							MinLength: 1,
+							MaxLength: 20,
+							Required:  true,
+						}}},
+						{Components: []discord.Component{{
+							Type:      discord.TextInputComponent,
+							CustomId:  "new",
+							Style:     discord.ShortInput,
+							Label:     "新しい単語",
+							Value:     nw,
+							MinLength: 1,
+							MaxLength: 20,
+							Required:  true,
+						}}},
+					},
+				}
+				interaction.Modal(modal)
 
-			if ok {
-				err := sess.Disconnect(vc.voice.GuildId)
-				if err != nil {
+			case "modal":
+
+				old, nw = interaction.Input("old"), interaction.Input("new")
+				if old == "" || nw == "" {
 					return
 				}
 
-				vcs.Delete(vc.voice.GuildId)
+				if !vc.replace(key, old, nw) {
+					missing()
+					return
+				}
 
-				if len(vc.dict) == 0 {
+				resp := &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: old + "を" + nw + "として保存したのだ", Color: green}},
+				}
+				interaction.Edit(resp)
+
+			case "delete":
+
+				if !vc.remove(key) {
+					missing()
 					return
 				}
 
-				if crt, _ := os.Create(filepath.Join("dict", vc.voice.GuildId+".dict")); crt != nil {
-					defer crt.Close()
-					gob.NewEncoder(crt).Encode(vc.dict)
+				resp := &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: old + "を辞書から削除したのだ", Color: green}},
 				}
+				interaction.Edit(resp)
 			}
 		},
 	}
@@ -689,15 +652,169 @@ func main() {
 		{
 			Name:        "help",
 			Description: "ヘルプメニューを表示するのだ",
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				resp := &discord.Response{
+					Content: ":question: ヘルプメニュー",
+					Embeds: []discord.Embed{{Description: "/help - このメニューを表示\n" +
+						"/ping - ping値を表示\n" +
+						"/join - 読み上げを開始\n" +
+						"/leave - 読み上げを終了\n" +
+						"/switch - キャラクターを変更\n" +
+						"/dict - 辞書を変更\n" +
+						"/export - 辞書を出力", Color: green}},
+				}
+				interaction.Reply(resp)
+			},
 		}, {
 			Name:        "ping",
 			Description: "ping値を返すのだ",
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				resp := &discord.Response{
+					Content: ":timer: レイテンシ",
+					Embeds:  []discord.Embed{{Description: strconv.FormatInt(bot.Latency, 10) + "ms", Color: green}},
+				}
+				interaction.Reply(resp)
+			},
 		}, {
 			Name:        "join",
 			Description: "読み上げを開始するのだ",
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				err := interaction.Defer(false)
+				if err != nil {
+					return
+				}
+
+				var ok bool
+				var voice *discord.Voice
+				if state, found := discord.Global.VoiceState(interaction.GuildId, interaction.Author.User.Id); found {
+					voice, err = sess.Connect(interaction.GuildId, state.ChannelID, false, true)
+					ok = err == nil
+				}
+
+				if !ok {
+					resp := &discord.Response{
+						Content: ":red_circle: 失敗...",
+						Embeds:  []discord.Embed{{Description: "ボイスチャンネルに接続できなかったのだ", Color: green}},
+					}
+					interaction.Edit(resp)
+					return
+				}
+
+				dict := make([]string, 0)
+				opn, err := os.Open(filepath.Join("dict", interaction.GuildId+".dict"))
+				if err == nil {
+					defer opn.Close()
+					err := gob.NewDecoder(opn).Decode(&dict)
+					if err != nil {
+						resp := &discord.Response{
+							Content: ":red_circle: 失敗...",
+							Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
+						}
+						interaction.Edit(resp)
+						return
+					}
+				}
+
+				vc := &vc{interaction.ChannelId, voice, new(sync.Mutex), dict, new(sync.Mutex), new(sync.Mutex), make(map[string]*discord.Message)}
+				vcs.Store(interaction.GuildId, vc)
+				status()
+
+				go func() {
+					for evt := range voice.Events {
+						if evt.Type != discord.VoiceClosed || evt.Err == nil {
+							continue
+						}
+
+						if any, ok := vcs.Load(interaction.GuildId); !ok || any != vc {
+							return
+						}
+
+						vcs.Delete(interaction.GuildId)
+						status()
+
+						vc.save(interaction.GuildId)
+					}
+				}()
+
+				resp := &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: "ボイスチャンネルに接続したのだ", Color: green}},
+				}
+				interaction.Edit(resp)
+
+				time.Sleep(time.Second)
+
+				opn, err = os.Open("greet.dca")
+				if err != nil {
+					return
+				}
+				defer opn.Close()
+
+				voice.Speak(true)
+				defer voice.Speak(false)
+
+				var ln int16
+				for {
+					err := binary.Read(opn, binary.LittleEndian, &ln)
+					if err != nil {
+						return
+					}
+
+					buf := make([]byte, ln)
+					err = binary.Read(opn, binary.LittleEndian, &buf)
+					if err != nil {
+						return
+					}
+
+					select {
+					case voice.Send <- buf:
+					case <-voice.Done():
+						return
+					}
+				}
+			},
 		}, {
 			Name:        "leave",
 			Description: "読み上げを終了するのだ",
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				err := interaction.Defer(false)
+				if err != nil {
+					return
+				}
+
+				any, ok := vcs.Load(interaction.GuildId)
+				if !ok {
+					resp := &discord.Response{
+						Content: ":red_circle: 失敗...",
+						Embeds:  []discord.Embed{{Description: "ボイスチャンネルが見つからなかったのだ", Color: green}},
+					}
+					interaction.Edit(resp)
+					return
+				}
+
+				vc := any.(*vc)
+
+				err = sess.Disconnect(interaction.GuildId)
+				if err != nil {
+					resp := &discord.Response{
+						Content: ":red_circle: 失敗...",
+						Embeds:  []discord.Embed{{Description: "ボイスチャンネルから切断できなかったのだ", Color: green}},
+					}
+					interaction.Edit(resp)
+					return
+				}
+
+				vcs.Delete(interaction.GuildId)
+				status()
+
+				resp := &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: "ボイスチャンネルから切断したのだ", Color: green}},
+				}
+				interaction.Edit(resp)
+
+				vc.save(vc.voice.GuildId)
+			},
 		}, {
 			Name:        "dict",
 			Description: "辞書を変更するのだ",
@@ -708,55 +825,222 @@ func main() {
 					Description: "置き換える単語",
 					MaxLength:   20,
 					MinLength:   1,
-					Required:    true,
 				}, {
 					Name:        "new",
 					Type:        discord.StringOption,
 					Description: "新しい単語",
 					MaxLength:   20,
 					MinLength:   1,
-					Required:    true,
 				},
 			},
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				err := interaction.Defer(false)
+				if err != nil {
+					return
+				}
+
+				any, ok := vcs.Load(interaction.GuildId)
+				if !ok {
+					resp := &discord.Response{
+						Content: ":red_circle: 失敗...",
+						Embeds:  []discord.Embed{{Description: "ボイスチャンネルが見つからなかったのだ", Color: green}},
+					}
+					interaction.Edit(resp)
+					return
+				}
+
+				vc := any.(*vc)
+
+				opts := interaction.Options()
+				old, _ := opts.String("old")
+				nw, _ := opts.String("new")
+
+				if old == "" || nw == "" {
+					dict := vc.snapshot()
+					seen := make(map[string]bool, len(dict)/2)
+					opts := make([]discord.SelectOption, 0, 25)
+					for idx := 0; idx+1 < len(dict) && len(opts) < 25; idx += 2 {
+						if seen[dict[idx]] {
+							continue
+						}
+						seen[dict[idx]] = true
+
+						opts = append(opts, discord.SelectOption{
+							Label: dict[idx] + " → " + dict[idx+1],
+							Value: dict[idx],
+						})
+					}
+
+					if len(opts) == 0 {
+						resp := &discord.Response{
+							Content: ":red_circle: 失敗...",
+							Embeds:  []discord.Embed{{Description: "辞書が空なのだ", Color: green}},
+						}
+						interaction.Edit(resp)
+						return
+					}
+
+					resp := &discord.Response{
+						Content: ":book: ユーザー辞書",
+						Components: []discord.Row{{Components: []discord.Component{{
+							Type:        discord.StringSelectComponent,
+							CustomId:    "dict:select",
+							Placeholder: "変更する単語を選ぶのだ",
+							Options:     opts,
+						}}}},
+					}
+					interaction.Edit(resp)
+					return
+				}
+
+				vc.add(old, nw)
+
+				resp := &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: old + "を" + nw + "として保存したのだ", Color: green}},
+				}
+				interaction.Edit(resp)
+			},
 		}, {
 			Name:        "switch",
 			Description: "キャラクターを変更",
 			Options: []discord.Option{
 				{
-					Name:        "speaker",
-					Type:        discord.StringOption,
-					Description: "新しいキャラクター",
-					MaxLength:   20,
-					MinLength:   1,
-					Required:    true,
-					Choices:     choises,
+					Name:         "speaker",
+					Type:         discord.StringOption,
+					Description:  "新しいキャラクター",
+					MaxLength:    20,
+					MinLength:    1,
+					AutoComplete: true,
 				},
 			},
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				speaker, err := interaction.Options().String("speaker")
+				if err != nil {
+					opts := make([]discord.SelectOption, 0, 25)
+					for _, speaker := range speakers {
+						if len(opts) == 25 {
+							break
+						}
+						opts = append(opts, discord.SelectOption{Label: speaker.Name, Value: speaker.Value.(string)})
+					}
+
+					resp := &discord.Response{
+						Content:   ":speaking_head: キャラクター選択",
+						Ephemeral: true,
+						Components: []discord.Row{{Components: []discord.Component{{
+							Type:        discord.StringSelectComponent,
+							CustomId:    "switch",
+							Placeholder: "キャラクターを選ぶのだ",
+							Options:     opts,
+						}}}},
+					}
+					interaction.Reply(resp)
+					return
+				}
+
+				err = interaction.Defer(true)
+				if err != nil {
+					return
+				}
+
+				swap(interaction, speaker)
+			},
+			Autocomplete: func(bot *discord.Bot, interaction *discord.Interaction) {
+				option := interaction.Focused()
+				if option == nil {
+					return
+				}
+
+				query, _ := option.Value.(string)
+				query = strings.ToLower(query)
+
+				choices := make([]discord.Choice, 0, 25)
+				for _, speaker := range speakers {
+					if len(choices) == 25 {
+						break
+					}
+					if strings.Contains(strings.ToLower(speaker.Name), query) {
+						choices = append(choices, speaker)
+					}
+				}
+
+				interaction.Autocomplete(choices)
+			},
 		}, {
 			Name:        "export",
 			Description: "辞書ファイルを出力するのだ",
-			Options: []discord.Option{
-				{
-					Name:        "encoding",
-					Type:        discord.StringOption,
-					Description: "使うファイル形式",
-					MaxLength:   20,
-					MinLength:   1,
-					Required:    true,
-					Choices: []discord.Choice{
-						{
-							Name:  "Gob",
-							Value: "gob",
-						}, {
-							Name:  "JSON",
-							Value: "json",
-						},
-					},
-				},
+			Handler: func(bot *discord.Bot, interaction *discord.Interaction) {
+				err := interaction.Defer(true)
+				if err != nil {
+					return
+				}
+
+				fail := &discord.Response{
+					Content: ":red_circle: 失敗...",
+					Embeds:  []discord.Embed{{Description: "辞書の読み込みに失敗したのだ", Color: green}},
+				}
+
+				byt, err := os.ReadFile(filepath.Join("dict", interaction.GuildId+".dict"))
+				if err != nil {
+					interaction.Edit(fail)
+					return
+				}
+
+				dict := make([]string, 0)
+				err = gob.NewDecoder(bytes.NewReader(byt)).Decode(&dict)
+				if err != nil {
+					interaction.Edit(fail)
+					return
+				}
+
+				jsn, err := json.MarshalIndent(dict, "", "  ")
+				if err != nil {
+					interaction.Edit(fail)
+					return
+				}
+
+				resp := &discord.Response{
+					Content: ":hourglass: 出力中...",
+					Embeds:  []discord.Embed{{Description: "ファイルを送信しているのだ", Color: green}},
+				}
+				interaction.Edit(resp)
+
+				files := []discord.File{
+					{Name: interaction.GuildId + ".dict", Content: byt},
+					{Name: interaction.GuildId + ".json", Content: jsn},
+				}
+
+				for idx := range files {
+					resp := &discord.Response{
+						Content:   fmt.Sprintf(":page_facing_up: %d/%d", idx+1, len(files)),
+						Ephemeral: true,
+						Files:     files[idx : idx+1],
+					}
+
+					_, err := interaction.Followup(resp)
+					if err != nil {
+						fail.Embeds[0].Description = "ファイルの送信に失敗したのだ"
+						interaction.Edit(fail)
+						return
+					}
+				}
+
+				resp = &discord.Response{
+					Content: ":green_circle: 成功!",
+					Embeds:  []discord.Embed{{Description: "ファイルを添付したのだ", Color: green}},
+				}
+				interaction.Edit(resp)
 			},
 		},
 	}
 
+	if guild := os.Getenv("GUILD"); guild != "" {
+		for idx := range sess.Commands {
+			sess.Commands[idx].GuildId = guild
+		}
+	}
+
 	tok := os.Getenv("TOKEN")
 	if tok == "" {
 		fmt.Println(errors.New("discord auth token not set"))
@@ -769,3 +1053,163 @@ func main() {
 		return
 	}
 }
+
+func (vc *vc) enqueue(msg *discord.Message) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	vc.queue[msg.Id] = msg
+}
+
+func (vc *vc) dequeue(msg *discord.Message) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	if vc.queue[msg.Id] == msg {
+		delete(vc.queue, msg.Id)
+	}
+}
+
+func (vc *vc) index(old string) int {
+	for idx := 0; idx+1 < len(vc.dict); idx += 2 {
+		if vc.dict[idx] == old {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (vc *vc) snapshot() []string {
+	vc.words.Lock()
+	defer vc.words.Unlock()
+
+	return append([]string(nil), vc.dict...)
+}
+
+func (vc *vc) save(guild string) {
+	dict := vc.snapshot()
+	if len(dict) == 0 {
+		return
+	}
+
+	if crt, _ := os.Create(filepath.Join("dict", guild+".dict")); crt != nil {
+		defer crt.Close()
+		gob.NewEncoder(crt).Encode(dict)
+	}
+}
+
+func (vc *vc) add(old, nw string) {
+	vc.words.Lock()
+	defer vc.words.Unlock()
+
+	if idx := vc.index(old); idx >= 0 {
+		vc.dict[idx+1] = nw
+		return
+	}
+	vc.dict = append(vc.dict, old, nw)
+}
+
+func (vc *vc) word(old string) (string, string, bool) {
+	vc.words.Lock()
+	defer vc.words.Unlock()
+
+	idx := vc.index(old)
+	if idx < 0 {
+		return "", "", false
+	}
+	return vc.dict[idx], vc.dict[idx+1], true
+}
+
+func (vc *vc) replace(key, old, nw string) bool {
+	vc.words.Lock()
+	defer vc.words.Unlock()
+
+	idx := vc.index(key)
+	if idx < 0 {
+		return false
+	}
+	if dup := vc.index(old); dup >= 0 && dup != idx {
+		vc.dict = append(vc.dict[:dup], vc.dict[dup+2:]...)
+		if dup < idx {
+			idx -= 2
+		}
+	}
+	vc.dict[idx], vc.dict[idx+1] = old, nw
+	return true
+}
+
+func (vc *vc) remove(old string) bool {
+	vc.words.Lock()
+	defer vc.words.Unlock()
+
+	idx := vc.index(old)
+	if idx < 0 {
+		return false
+	}
+	vc.dict = append(vc.dict[:idx], vc.dict[idx+2:]...)
+	return true
+}
+
+func (vc *vc) current(msg *discord.Message) bool {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	return vc.queue[msg.Id] == msg
+}
+
+func (vc *vc) edited(msg *discord.Message) bool {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	old, ok := vc.queue[msg.Id]
+
+	return ok && old.Content != msg.Content
+}
+
+func (vc *vc) cancel(id string) {
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+
+	delete(vc.queue, id)
+}
+
+func fetch(key string) ([]discord.Choice, error) {
+	get, err := client.Get(index + "?key=" + key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer get.Body.Close()
+	if get.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code:%d", get.StatusCode)
+	}
+
+	var list []struct {
+		Name   string `json:"name"`
+		Styles []struct {
+			Name string `json:"name"`
+			Id   int    `json:"id"`
+		} `json:"styles"`
+	}
+
+	err = json.NewDecoder(get.Body).Decode(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	choices := make([]discord.Choice, 0, len(list))
+	for _, speaker := range list {
+		for _, style := range speaker.Styles {
+			choices = append(choices, discord.Choice{
+				Name:  speaker.Name + ": " + style.Name,
+				Value: strconv.Itoa(style.Id),
+			})
+		}
+	}
+
+	if len(choices) == 0 {
+		return nil, errors.New("no speakers found")
+	}
+
+	return choices, nil
+}
@@ -0,0 +1,352 @@
+package socket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"zundago/dns"
+)
+
+type Dialer struct {
+	Proxy            func(req *http.Request) (*url.URL, error)
+	TLSConfig        *tls.Config
+	HandshakeTimeout time.Duration
+	Compress         bool
+	Stream           bool
+}
+
+var (
+	DefaultDialer = &Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: time.Second * 45,
+	}
+)
+
+func Dial(raw string) (*Conn, error) {
+	return DefaultDialer.DialContext(context.Background(), raw, nil)
+}
+
+func DialContext(ctx context.Context, raw string, header http.Header) (*Conn, error) {
+	return DefaultDialer.DialContext(ctx, raw, header)
+}
+
+func (dialer *Dialer) Dial(raw string, header http.Header) (*Conn, error) {
+	return dialer.DialContext(context.Background(), raw, header)
+}
+
+func (dialer *Dialer) DialContext(ctx context.Context, raw string, header http.Header) (*Conn, error) {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialer.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.HandshakeTimeout)
+		defer cancel()
+	}
+
+	if dialer.Compress {
+		header = header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set("Sec-WebSocket-Extensions", "permessage-deflate; client_no_context_takeover")
+	}
+
+	tcp, err := dialer.dial(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newConn(tcp)
+	conn.stream = dialer.Stream
+
+	err = conn.handshake(ctx, uri, header)
+	if err != nil {
+		tcp.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if conn.stream {
+		conn.pipe = newPipe()
+	}
+
+	return conn, nil
+}
+
+func (dialer *Dialer) dial(ctx context.Context, uri *url.URL) (net.Conn, error) {
+	var scheme string
+	port := uri.Port()
+
+	switch uri.Scheme {
+	case "ws":
+		scheme = "http"
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		scheme = "https"
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil, errors.New("bad uri scheme")
+	}
+
+	addr := net.JoinHostPort(uri.Hostname(), port)
+
+	var proxy *url.URL
+	if dialer.Proxy != nil {
+		var err error
+
+		proxy, err = dialer.Proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if proxy == nil {
+		conn, err = dns.Dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.tunnel(ctx, proxy, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if uri.Scheme == "ws" {
+		return conn, nil
+	}
+
+	cfg := new(tls.Config)
+	if dialer.TLSConfig != nil {
+		cfg = dialer.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = uri.Hostname()
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (dialer *Dialer) tunnel(ctx context.Context, proxy *url.URL, addr string) (net.Conn, error) {
+	port := proxy.Port()
+
+	switch proxy.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	case "socks5", "socks5h":
+		if port == "" {
+			port = "1080"
+		}
+	default:
+		return nil, errors.New("unsupported proxy scheme:" + proxy.Scheme)
+	}
+
+	conn, err := dns.Dialer.DialContext(ctx, "tcp", net.JoinHostPort(proxy.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if proxy.Scheme == "https" {
+		cfg := new(tls.Config)
+		if dialer.TLSConfig != nil {
+			cfg = dialer.TLSConfig.Clone()
+		}
+		cfg.ServerName = proxy.Hostname()
+
+		tlsConn := tls.Client(conn, cfg)
+
+		err := tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if proxy.Scheme == "socks5" || proxy.Scheme == "socks5h" {
+		err = socks(conn, proxy.User, addr)
+	} else {
+		err = connect(conn, proxy.User, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	str := "CONNECT " + addr + " HTTP/1.1\r\n" +
+		"Host: " + addr + "\r\n"
+	if user != nil {
+		pass, _ := user.Password()
+		str += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+pass)) + "\r\n"
+	}
+	str += "\r\n"
+
+	_, err := io.WriteString(conn, str)
+	if err != nil {
+		return err
+	}
+
+	req := &http.Request{Method: http.MethodConnect}
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad proxy status code:%d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func socks(conn net.Conn, user *url.Userinfo, addr string) error {
+	host, str, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.Atoi(str)
+	if err != nil {
+		return err
+	}
+
+	if len(host) > 255 {
+		return errors.New("proxy host too long")
+	}
+
+	method := byte(0x00)
+	if user != nil {
+		method = 0x02
+	}
+
+	_, err = conn.Write([]byte{0x05, 0x01, method})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0x05 || buf[1] != method {
+		return errors.New("proxy rejected auth method")
+	}
+
+	if user != nil {
+		pass, _ := user.Password()
+		if len(user.Username()) > 255 || len(pass) > 255 {
+			return errors.New("proxy credentials too long")
+		}
+
+		auth := []byte{0x01, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(pass)))
+		auth = append(auth, pass...)
+
+		_, err := conn.Write(auth)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			return err
+		}
+		if buf[1] != 0x00 {
+			return errors.New("proxy authentication failed")
+		}
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		req = append(req, 0x01)
+		req = append(req, ip.To4()...)
+	case ip != nil:
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	default:
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	_, err = io.ReadFull(conn, head)
+	if err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return errors.New("proxy connect failed:" + strconv.Itoa(int(head[1])))
+	}
+
+	var ln int
+	switch head[3] {
+	case 0x01:
+		ln = net.IPv4len
+	case 0x04:
+		ln = net.IPv6len
+	case 0x03:
+		_, err := io.ReadFull(conn, buf[:1])
+		if err != nil {
+			return err
+		}
+		ln = int(buf[0])
+	default:
+		return errors.New("bad proxy address type")
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, ln+2))
+
+	return err
+}
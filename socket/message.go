@@ -0,0 +1,482 @@
+package socket
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+type header struct {
+	fin  bool
+	rsv  byte
+	op   int
+	ln   int64
+	mask bool
+	key  [4]byte
+}
+
+type reader struct {
+	conn *Conn
+	head *header
+	zip  bool
+	pos  int64
+	size int64
+	err  error
+}
+
+type writer struct {
+	conn *Conn
+	typ  int
+	zip  *flate.Writer
+	out  *bytes.Buffer
+	buf  []byte
+	sent bool
+	done bool
+}
+
+func (conn *Conn) NextReader() (int, io.Reader, error) {
+
+	conn.read.Lock()
+	defer conn.read.Unlock()
+
+	op, err := conn.next()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if conn.cur.zip || op == Binary && conn.stream {
+		data, err := conn.rest()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if op == Binary && conn.stream {
+			data, err = conn.inflate(data)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+
+		return op, bytes.NewReader(data), nil
+	}
+
+	return op, &locked{conn.cur}, nil
+}
+
+func (conn *Conn) NextWriter(typ int) (io.WriteCloser, error) {
+	if typ != Text && typ != Binary {
+		return nil, errors.New("bad message type:" + strconv.Itoa(typ))
+	}
+
+	conn.write.Lock()
+
+	wr := &writer{conn: conn, typ: typ}
+	if conn.deflate {
+		wr.out = new(bytes.Buffer)
+		wr.zip, _ = flate.NewWriter(wr.out, flate.DefaultCompression)
+	}
+
+	return wr, nil
+}
+
+func (conn *Conn) message() (int, []byte, error) {
+	op, err := conn.next()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data, err := conn.rest()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return op, data, nil
+}
+
+func (conn *Conn) rest() ([]byte, error) {
+	cur := conn.cur
+
+	data, err := io.ReadAll(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	if cur.zip {
+		return conn.decompress(data)
+	}
+
+	return data, nil
+}
+
+func (conn *Conn) next() (int, error) {
+	if conn.fail != nil {
+		return 0, conn.fail
+	}
+
+	op, err := conn.advance()
+	if err != nil {
+		conn.fail = err
+	}
+
+	return op, err
+}
+
+func (conn *Conn) advance() (int, error) {
+	if conn.cur != nil {
+		_, err := io.Copy(io.Discard, conn.cur)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	head, err := conn.frame()
+	if err != nil {
+		return 0, err
+	}
+
+	switch head.op {
+	case Text, Binary:
+	case Continuation:
+		return 0, errors.New("unexpected continuation frame")
+	default:
+		return 0, errors.New("unknown op code:" + strconv.Itoa(head.op))
+	}
+
+	conn.cur = &reader{conn: conn, head: head, zip: head.rsv&rsv1 != 0}
+
+	return head.op, nil
+}
+
+func (conn *Conn) frame() (*header, error) {
+	for {
+		head, err := conn.head()
+		if err != nil {
+			return nil, err
+		}
+
+		if head.op < Close {
+			return head, nil
+		}
+
+		data := make([]byte, head.ln)
+		_, err = io.ReadFull(conn.reader, data)
+		if err != nil {
+			return nil, err
+		}
+		head.unmask(data, 0)
+
+		switch head.op {
+		case Ping:
+			err := conn.control(Pong, data)
+			if err != nil {
+				return nil, err
+			}
+
+		case Pong:
+
+		case Close:
+			return nil, conn.closed(data)
+
+		default:
+			return nil, errors.New("unknown op code:" + strconv.Itoa(head.op))
+		}
+	}
+}
+
+func (conn *Conn) head() (*header, error) {
+	var byt byte
+
+	byt, err := conn.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	head := &header{fin: byt&0x80 != 0, rsv: byt & rsv, op: int(byt & 0x0f)}
+
+	byt, err = conn.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	head.mask = byt&0x80 != 0
+	byt &= 0x7f
+
+	var fields int
+	switch {
+	case byt <= 125:
+		head.ln = int64(byt)
+	case byt == 126:
+		fields = 2
+	case byt == 127:
+		fields = 8
+	}
+
+	for idx := 0; idx < fields; idx++ {
+		byt, err = conn.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if fields == 8 && idx == 0 {
+			byt &= 0x7f
+		}
+		head.ln = head.ln*256 + int64(byt)
+	}
+
+	if head.ln > conn.limit {
+		return nil, errors.New("frame length too large")
+	}
+
+	if head.op >= Close && (head.ln > 125 || !head.fin) {
+		return nil, errors.New("bad control frame")
+	}
+
+	if head.rsv&^rsv1 != 0 || head.rsv != 0 && (!conn.deflate || head.op != Text && head.op != Binary) {
+		return nil, errors.New("bad reserved bits")
+	}
+
+	if conn.server && !head.mask {
+		return nil, errors.New("unmasked client frame")
+	}
+
+	if head.mask {
+		_, err := io.ReadFull(conn.reader, head.key[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return head, nil
+}
+
+func (head *header) unmask(data []byte, pos int64) {
+	if !head.mask {
+		return
+	}
+
+	for idx := range data {
+		data[idx] ^= head.key[(pos+int64(idx))%4]
+	}
+}
+
+func (conn *Conn) control(op int, data []byte) error {
+
+	conn.write.Lock()
+	defer conn.write.Unlock()
+
+	return conn.put(true, op, data)
+}
+
+func (conn *Conn) closed(data []byte) error {
+	closed := &CloseError{Code: NoStatus}
+
+	if len(data) >= 2 {
+		closed.Code = int(binary.BigEndian.Uint16(data))
+		closed.Reason = string(data[2:])
+	}
+
+	conn.write.Lock()
+	defer conn.write.Unlock()
+
+	if !conn.sent {
+		conn.sent = true
+
+		stt := make([]byte, 2)
+		binary.BigEndian.PutUint16(stt, uint16(Normal))
+		if closed.Code != NoStatus {
+			binary.BigEndian.PutUint16(stt, uint16(closed.Code))
+		}
+
+		conn.put(true, Close, stt)
+	}
+
+	return closed
+}
+
+func (conn *Conn) put(fin bool, op int, val []byte) error {
+	var buf []byte
+	var byt byte
+
+	byt = byte(op)
+	if fin {
+		byt |= 0x80
+	}
+	buf = append(buf, byt)
+
+	byt = 0
+	if !conn.server {
+		byt = 0x80
+	}
+
+	var fields int
+	switch {
+	case len(val) <= 125:
+		byt |= byte(len(val))
+	case len(val) < 65536:
+		byt |= 126
+		fields = 2
+	default:
+		byt |= 127
+		fields = 8
+	}
+	buf = append(buf, byt)
+
+	for idx := 0; idx < fields; idx++ {
+		byt = byte((len(val) >> uint((fields-idx-1)*8)) & 0xff)
+		buf = append(buf, byt)
+	}
+
+	if conn.server {
+		conn.writer.Write(buf)
+		conn.writer.Write(val)
+
+		return conn.writer.Flush()
+	}
+
+	key := make([]byte, 4)
+
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, key...)
+
+	conn.writer.Write(buf)
+	data := make([]byte, len(val))
+	for idx := range data {
+		data[idx] = val[idx] ^ key[idx%4]
+	}
+	conn.writer.Write(data)
+
+	return conn.writer.Flush()
+}
+
+func (rd *reader) Read(val []byte) (int, error) {
+	if rd.err != nil {
+		return 0, rd.err
+	}
+
+	conn := rd.conn
+
+	for rd.pos == rd.head.ln {
+		if rd.head.fin {
+			rd.err = io.EOF
+			if conn.cur == rd {
+				conn.cur = nil
+			}
+			return 0, io.EOF
+		}
+
+		head, err := conn.frame()
+		if err != nil {
+			rd.fail(err)
+			return 0, err
+		}
+		if head.op != Continuation {
+			rd.fail(errors.New("unexpected data frame during fragmented message"))
+			return 0, rd.err
+		}
+
+		rd.head = head
+		rd.pos = 0
+	}
+
+	if left := rd.head.ln - rd.pos; int64(len(val)) > left {
+		val = val[:left]
+	}
+
+	ln, err := conn.reader.Read(val)
+	rd.head.unmask(val[:ln], rd.pos)
+	rd.pos += int64(ln)
+	rd.size += int64(ln)
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && rd.size > conn.limit {
+		err = errors.New("message length too large")
+	}
+	if err != nil {
+		rd.fail(err)
+	}
+
+	return ln, err
+}
+
+func (rd *reader) fail(err error) {
+	rd.err = err
+	rd.conn.fail = err
+}
+
+type locked struct {
+	rd *reader
+}
+
+func (lck *locked) Read(val []byte) (int, error) {
+
+	lck.rd.conn.read.Lock()
+	defer lck.rd.conn.read.Unlock()
+
+	return lck.rd.Read(val)
+}
+
+func (wr *writer) Write(val []byte) (int, error) {
+	if wr.done {
+		return 0, errors.New("write to closed writer")
+	}
+
+	if wr.zip == nil {
+		wr.buf = append(wr.buf, val...)
+	} else {
+		_, err := wr.zip.Write(val)
+		if err != nil {
+			return 0, err
+		}
+		wr.buf = append(wr.buf, wr.out.Bytes()...)
+		wr.out.Reset()
+	}
+
+	for len(wr.buf) > chunk+len(suffix) {
+		err := wr.flush(false, wr.buf[:chunk])
+		if err != nil {
+			return 0, err
+		}
+		wr.buf = wr.buf[chunk:]
+	}
+
+	return len(val), nil
+}
+
+func (wr *writer) Close() error {
+	if wr.done {
+		return errors.New("writer already closed")
+	}
+	wr.done = true
+
+	defer wr.conn.write.Unlock()
+
+	if wr.zip != nil {
+		err := wr.zip.Flush()
+		if err != nil {
+			return err
+		}
+		wr.buf = bytes.TrimSuffix(append(wr.buf, wr.out.Bytes()...), suffix)
+	}
+
+	return wr.flush(true, wr.buf)
+}
+
+func (wr *writer) flush(fin bool, data []byte) error {
+	op := wr.typ
+	if wr.zip != nil {
+		op |= rsv1
+	}
+	if wr.sent {
+		op = Continuation
+	}
+	wr.sent = true
+
+	return wr.conn.put(fin, op, data)
+}
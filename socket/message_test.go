@@ -0,0 +1,257 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func pair(t *testing.T, dialer *Dialer, header http.Header) (*Conn, *Conn) {
+	conns := make(chan *Conn, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		conn, err := Upgrade(res, req, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := <-conns
+	if server == nil {
+		t.FailNow()
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	return client, server
+}
+
+func TestFragmented(t *testing.T) {
+	client, server := pair(t, &Dialer{}, nil)
+
+	msg := strings.Repeat("zundamon", chunk)
+
+	go func() {
+		wr, err := client.NextWriter(Text)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for idx := 0; idx < len(msg); idx += 1000 {
+			end := idx + 1000
+			if end > len(msg) {
+				end = len(msg)
+			}
+			wr.Write([]byte(msg[idx:end]))
+		}
+		wr.Close()
+	}()
+
+	op, rd, err := server.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != Text || string(data) != msg {
+		t.Fatalf("got %d %d bytes want %d", op, len(data), len(msg))
+	}
+}
+
+func TestControlBetweenFragments(t *testing.T) {
+	client, server := pair(t, &Dialer{}, nil)
+
+	go func() {
+		server.write.Lock()
+		defer server.write.Unlock()
+
+		server.put(false, Text, []byte("zun"))
+		server.put(true, Ping, []byte("ping"))
+		server.put(false, Continuation, []byte("da"))
+		server.put(true, Pong, nil)
+		server.put(true, Continuation, []byte("mon"))
+		server.put(true, Binary, []byte{1, 2, 3})
+	}()
+
+	op, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != Text || string(data) != "zundamon" {
+		t.Fatalf("got %d %q", op, data)
+	}
+
+	op, data, err = client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != Binary || !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Fatalf("got %d %v", op, data)
+	}
+
+	head, err := server.head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pong := make([]byte, head.ln)
+	io.ReadFull(server.reader, pong)
+	head.unmask(pong, 0)
+	if head.op != Pong || string(pong) != "ping" {
+		t.Fatalf("got %d %q", head.op, pong)
+	}
+}
+
+func TestBadFragments(t *testing.T) {
+	tests := []struct {
+		frames func(conn *Conn)
+		want   string
+	}{
+		{func(conn *Conn) {
+			conn.put(true, Continuation, []byte("zunda"))
+		}, "unexpected continuation frame"},
+		{func(conn *Conn) {
+			conn.put(false, Text, []byte("zun"))
+			conn.put(true, Text, []byte("damon"))
+		}, "unexpected data frame during fragmented message"},
+		{func(conn *Conn) {
+			conn.put(false, Ping, nil)
+		}, "bad control frame"},
+	}
+
+	for _, test := range tests {
+		client, server := pair(t, &Dialer{}, nil)
+
+		go test.frames(server)
+
+		_, _, err := client.ReadMessage()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("got %v want %s", err, test.want)
+		}
+
+		_, _, err = client.ReadMessage()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("sticky: got %v want %s", err, test.want)
+		}
+	}
+}
+
+func TestCloseError(t *testing.T) {
+	client, server := pair(t, &Dialer{}, nil)
+
+	go func() {
+		data := binary.BigEndian.AppendUint16(nil, 4004)
+		server.WriteMessage(Close, append(data, "Authentication failed."...))
+	}()
+
+	_, _, err := client.ReadMessage()
+
+	var closed *CloseError
+	if !errors.As(err, &closed) || closed.Code != 4004 || closed.Reason != "Authentication failed." {
+		t.Fatalf("got %v", err)
+	}
+	if err.Error() != "websocket closed:4004 Authentication failed." {
+		t.Fatalf("got %q", err.Error())
+	}
+
+	_, _, err = server.ReadMessage()
+	if !errors.As(err, &closed) || closed.Code != 4004 || closed.Reason != "" {
+		t.Fatalf("echo: got %v", err)
+	}
+
+	client, server = pair(t, &Dialer{}, nil)
+
+	go server.WriteMessage(Close, nil)
+
+	_, _, err = client.ReadMessage()
+	if !errors.As(err, &closed) || closed.Code != NoStatus {
+		t.Fatalf("empty: got %v", err)
+	}
+
+	_, _, err = server.ReadMessage()
+	if !errors.As(err, &closed) || closed.Code != Normal {
+		t.Fatalf("empty echo: got %v", err)
+	}
+}
+
+func TestCloseRace(t *testing.T) {
+	client, server := pair(t, &Dialer{}, nil)
+
+	go server.WriteMessage(Close, binary.BigEndian.AppendUint16(nil, Normal))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.WriteClose(Normal)
+	}()
+
+	_, _, err := client.ReadMessage()
+
+	var closed *CloseError
+	if !errors.As(err, &closed) || closed.Code != Normal {
+		t.Fatalf("got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = server.ReadMessage()
+	if !errors.As(err, &closed) || closed.Code != Normal {
+		t.Fatalf("echo: got %v", err)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	client, server := pair(t, &Dialer{}, nil)
+	client.SetReadLimit(8)
+
+	go server.WriteMessage(Text, []byte("zundamon!"))
+
+	_, _, err := client.ReadMessage()
+	if err == nil || err.Error() != "frame length too large" {
+		t.Fatalf("got %v", err)
+	}
+
+	client, server = pair(t, &Dialer{}, nil)
+	client.SetReadLimit(8)
+
+	go func() {
+		server.write.Lock()
+		defer server.write.Unlock()
+
+		server.put(false, Text, []byte("zunda"))
+		server.put(true, Continuation, []byte("mon!"))
+	}()
+
+	_, _, err = client.ReadMessage()
+	if err == nil || err.Error() != "message length too large" {
+		t.Fatalf("got %v", err)
+	}
+
+	client, server = pair(t, &Dialer{}, nil)
+	client.SetReadLimit(8)
+	client.SetReadLimit(0)
+
+	go server.WriteMessage(Text, []byte("zundamon!"))
+
+	_, data, err := client.ReadMessage()
+	if err != nil || string(data) != "zundamon!" {
+		t.Fatalf("reset: got %q %v", data, err)
+	}
+}
@@ -0,0 +1,152 @@
+package socket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func Upgrade(res http.ResponseWriter, req *http.Request, header http.Header) (*Conn, error) {
+	if req.Method != http.MethodGet {
+		http.Error(res, "bad method", http.StatusMethodNotAllowed)
+		return nil, errors.New("bad method")
+	}
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		http.Error(res, "bad upgrade header", http.StatusBadRequest)
+		return nil, errors.New("bad upgrade header")
+	}
+	if !token(req.Header, "Connection", "upgrade") {
+		http.Error(res, "bad connection header", http.StatusBadRequest)
+		return nil, errors.New("bad connection header")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != strconv.Itoa(version) {
+		res.Header().Set("Sec-WebSocket-Version", strconv.Itoa(version))
+		http.Error(res, "unsupported version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported version")
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(res, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+
+	hijacker, ok := res.(http.Hijacker)
+	if !ok {
+		http.Error(res, "hijacking not supported", http.StatusInternalServerError)
+		return nil, errors.New("hijacking not supported")
+	}
+
+	deflate, takeover := negotiate(req.Header.Values("Sec-WebSocket-Extensions"))
+
+	tcp, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sha := sha1.Sum([]byte(key + guid))
+
+	str := []string{
+		"HTTP/1.1 101 Switching Protocols\r\n",
+		"Upgrade: websocket\r\n",
+		"Connection: Upgrade\r\n",
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sha[:]) + "\r\n",
+	}
+	if deflate {
+		str = append(str, "Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover\r\n")
+	}
+	for name, vals := range header {
+		for _, val := range vals {
+			str = append(str, name+": "+val+"\r\n")
+		}
+	}
+	str = append(str, "\r\n")
+
+	for idx := range str {
+		_, err := buf.WriteString(str[idx])
+		if err != nil {
+			tcp.Close()
+			return nil, err
+		}
+	}
+
+	err = buf.Flush()
+	if err != nil {
+		tcp.Close()
+		return nil, err
+	}
+
+	conn := newConn(tcp)
+	conn.reader = buf.Reader
+	conn.writer = bufio.NewWriter(tcp)
+	conn.server = true
+	conn.deflate = deflate
+	conn.takeover = takeover
+
+	return conn, nil
+}
+
+func negotiate(offers []string) (bool, bool) {
+	for _, offer := range extensions(offers) {
+		if offer[0] != "permessage-deflate" {
+			continue
+		}
+
+		takeover := true
+		valid := true
+		for _, param := range offer[1:] {
+			name, val, _ := strings.Cut(param, "=")
+			switch name {
+			case "client_no_context_takeover":
+				takeover = false
+			case "server_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				valid = strings.Trim(val, `"`) == "15"
+			default:
+				valid = false
+			}
+		}
+
+		if valid {
+			return true, takeover
+		}
+	}
+
+	return false, false
+}
+
+func extensions(vals []string) [][]string {
+	var list [][]string
+
+	for _, val := range vals {
+		for _, ext := range strings.Split(val, ",") {
+			params := strings.Split(ext, ";")
+			for idx := range params {
+				params[idx] = strings.TrimSpace(params[idx])
+			}
+			if params[0] == "" {
+				continue
+			}
+
+			list = append(list, params)
+		}
+	}
+
+	return list
+}
+
+func token(header http.Header, name string, want string) bool {
+	for _, val := range header.Values(name) {
+		for _, tok := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(tok), want) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
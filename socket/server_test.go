@@ -0,0 +1,183 @@
+package socket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echo(t *testing.T, from *Conn, to *Conn, msgs []string) {
+	go func() {
+		for _, msg := range msgs {
+			err := from.WriteMessage(Text, []byte(msg))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for _, msg := range msgs {
+		op, data, err := to.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != Text || string(data) != msg {
+			t.Fatalf("got %d %q want %q", op, data, msg)
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	msgs := []string{"zundamon", strings.Repeat("zunda", chunk), "", "mochi"}
+
+	tests := []struct {
+		name     string
+		dialer   *Dialer
+		header   http.Header
+		deflate  bool
+		takeover bool
+	}{
+		{"plain", &Dialer{}, nil, false, false},
+		{"deflate", &Dialer{Compress: true}, nil, true, false},
+		{"takeover", &Dialer{}, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate"}}, true, true},
+		{"rejected", &Dialer{}, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; server_max_window_bits=10"}}, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := pair(t, test.dialer, test.header)
+
+			if client.deflate != test.deflate || server.deflate != test.deflate {
+				t.Fatalf("deflate: client %v server %v want %v", client.deflate, server.deflate, test.deflate)
+			}
+			if client.takeover || server.takeover != test.takeover {
+				t.Fatalf("takeover: client %v server %v want %v", client.takeover, server.takeover, test.takeover)
+			}
+
+			echo(t, client, server, msgs)
+			echo(t, server, client, msgs)
+
+			go func() {
+				wr, err := server.NextWriter(Binary)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				wr.Write([]byte(msgs[1]))
+				wr.Write([]byte(msgs[1]))
+				wr.Close()
+			}()
+
+			op, rd, err := client.NextReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rd)
+			if err != nil || op != Binary || string(data) != msgs[1]+msgs[1] {
+				t.Fatalf("got %d %d bytes %v", op, len(data), err)
+			}
+		})
+	}
+}
+
+func TestContextTakeover(t *testing.T) {
+	client, server := pair(t, &Dialer{}, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate"}})
+
+	msgs := []string{strings.Repeat("zundamon", 64), strings.Repeat("zundamon", 64), "zundamon mochi"}
+
+	go func() {
+		buf := new(bytes.Buffer)
+		zip, _ := flate.NewWriter(buf, flate.BestCompression)
+
+		client.write.Lock()
+		defer client.write.Unlock()
+
+		for _, msg := range msgs {
+			zip.Write([]byte(msg))
+			zip.Flush()
+
+			client.put(true, Text|rsv1, bytes.TrimSuffix(buf.Bytes(), suffix))
+			buf.Reset()
+		}
+	}()
+
+	for _, msg := range msgs {
+		_, data, err := server.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != msg {
+			t.Fatalf("got %q want %q", data, msg)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		offers   []string
+		deflate  bool
+		takeover bool
+	}{
+		{nil, false, false},
+		{[]string{"x-webkit-deflate-frame"}, false, false},
+		{[]string{"permessage-deflate"}, true, true},
+		{[]string{"permessage-deflate; client_no_context_takeover"}, true, false},
+		{[]string{"permessage-deflate; client_max_window_bits; server_no_context_takeover"}, true, true},
+		{[]string{`permessage-deflate; server_max_window_bits="15"`}, true, true},
+		{[]string{"permessage-deflate; server_max_window_bits=10, permessage-deflate; client_no_context_takeover"}, true, false},
+		{[]string{"permessage-deflate; mystery"}, false, false},
+	}
+
+	for _, test := range tests {
+		deflate, takeover := negotiate(test.offers)
+		if deflate != test.deflate || takeover != test.takeover {
+			t.Errorf("%q: got %v %v want %v %v", test.offers, deflate, takeover, test.deflate, test.takeover)
+		}
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		conn, err := Upgrade(res, req, nil)
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		method string
+		header http.Header
+		status int
+	}{
+		{http.MethodPost, nil, http.StatusMethodNotAllowed},
+		{http.MethodGet, nil, http.StatusBadRequest},
+		{http.MethodGet, http.Header{"Upgrade": {"websocket"}, "Connection": {"keep-alive, Upgrade"}}, http.StatusUpgradeRequired},
+		{http.MethodGet, http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}, "Sec-Websocket-Version": {"13"}}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, vals := range test.header {
+			req.Header[name] = vals
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("%s %v: got %d want %d", test.method, test.header, res.StatusCode, test.status)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package socket
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"compress/zlib"
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -18,7 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"zundago/dns"
+	"time"
 )
 
 type Conn struct {
@@ -27,62 +29,102 @@ type Conn struct {
 	conn   net.Conn
 	read   *sync.Mutex
 	write  *sync.Mutex
+	cur    *reader
+	fail   error
+	limit  int64
+	stream bool
+	pipe   *pipe
+	sent   bool
+	server bool
+
+	deflate  bool
+	takeover bool
+	prev     []byte
 }
 
-type writer struct {
-	buf *bufio.Writer
-	typ int
+type pipe struct {
+	in   chan []byte
+	out  chan []byte
+	done chan struct{}
+	once *sync.Once
+	buf  []byte
+	fed  bool
+	err  error
+}
+
+type CloseError struct {
+	Code   int
+	Reason string
 }
 
 const (
 	version = 13
 	guid    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
 	max     = 32 << 20
+	window  = 32 << 10
+	chunk   = 4 << 10
+	rsv     = 0x70
+	rsv1    = 0x40
 )
 
-const (
-	Text    = 1
-	Binary  = 2
-	Close   = 8
-	Ping    = 9
-	Pong    = 10
-	Unknown = 255
+var (
+	suffix = []byte{0x00, 0x00, 0xff, 0xff}
+	final  = []byte{0x03, 0x00}
 )
 
-func dial(uri *url.URL) (net.Conn, error) {
-	if uri.Scheme == "ws" {
-		return dns.Dialer.Dial("tcp", net.JoinHostPort(uri.Hostname(), "80"))
-	}
-	if uri.Scheme == "wss" {
-		return tls.DialWithDialer(dns.Dialer, "tcp", net.JoinHostPort(uri.Hostname(), "443"), nil)
-	}
-
-	return nil, errors.New("bad uri scheme")
-}
+const (
+	Continuation = 0
+	Text         = 1
+	Binary       = 2
+	Close        = 8
+	Ping         = 9
+	Pong         = 10
+	Unknown      = 255
+)
 
-func Dial(raw string) (*Conn, error) {
-	conn := new(Conn)
+const (
+	Normal   = 1000
+	Away     = 1001
+	Protocol = 1002
+	NoStatus = 1005
+	Abnormal = 1006
+	TooLarge = 1009
+	Internal = 1011
+)
 
-	uri, err := url.Parse(raw)
-	if err != nil {
-		return nil, err
+func newConn(raw net.Conn) *Conn {
+	return &Conn{
+		reader: bufio.NewReader(raw),
+		writer: bufio.NewWriter(raw),
+		conn:   raw,
+		read:   new(sync.Mutex),
+		write:  new(sync.Mutex),
+		limit:  max,
 	}
+}
 
-	conn.conn, err = dial(uri)
-	if err != nil {
-		return nil, err
+func (conn *Conn) handshake(ctx context.Context, uri *url.URL, header http.Header) error {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		conn.conn.SetDeadline(deadline)
+		defer conn.conn.SetDeadline(time.Time{})
 	}
 
-	conn.reader = bufio.NewReader(conn.conn)
-	conn.writer = bufio.NewWriter(conn.conn)
+	stop := make(chan struct{})
+	defer close(stop)
 
-	conn.read = new(sync.Mutex)
-	conn.write = new(sync.Mutex)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
 
 	key := make([]byte, 16)
-	_, err = io.ReadFull(rand.Reader, key)
+	_, err := io.ReadFull(rand.Reader, key)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	nonce := make([]byte, 24)
@@ -96,58 +138,88 @@ func Dial(raw string) (*Conn, error) {
 		"Sec-WebSocket-Key: " + string(nonce) + "\r\n",
 		"Sec-WebSocket-Version: " + strconv.Itoa(version) + "\r\n",
 	}
+	for name, vals := range header {
+		for _, val := range vals {
+			str = append(str, name+": "+val+"\r\n")
+		}
+	}
 	for idx := range str {
 		_, err := conn.writer.WriteString(str[idx])
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	_, err = conn.writer.WriteString("\r\n")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	err = conn.writer.Flush()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	req := &http.Request{Method: http.MethodGet}
 	res, err := http.ReadResponse(conn.reader, req)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer res.Body.Close()
+
 	if res.StatusCode != http.StatusSwitchingProtocols {
-		return nil, fmt.Errorf("bad status code:%d", res.StatusCode)
+		return fmt.Errorf("bad status code:%d", res.StatusCode)
 	}
 	if strings.ToLower(res.Header.Get("Upgrade")) != "websocket" {
-		return nil, errors.New("bad upgrade header")
+		return errors.New("bad upgrade header")
 	}
 	if strings.ToLower(res.Header.Get("Connection")) != "upgrade" {
-		return nil, errors.New("bad connection header")
+		return errors.New("bad connection header")
 	}
-	defer res.Body.Close()
 
 	sha := sha1.New()
 	_, err = sha.Write(nonce)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	_, err = sha.Write([]byte(guid))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	exp := make([]byte, 28)
 	base64.StdEncoding.Encode(exp, sha.Sum(nil))
 
 	if res.Header.Get("Sec-WebSocket-Accept") != string(exp) {
-		return nil, errors.New("mismatched challenge response")
+		return errors.New("mismatched challenge response")
 	}
 
-	return conn, nil
+	offered := false
+	for _, offer := range extensions(header.Values("Sec-WebSocket-Extensions")) {
+		offered = offered || offer[0] == "permessage-deflate"
+	}
+
+	for _, ext := range extensions(res.Header.Values("Sec-WebSocket-Extensions")) {
+		if ext[0] != "permessage-deflate" || !offered {
+			return errors.New("unexpected extension:" + ext[0])
+		}
+
+		conn.deflate = true
+		conn.takeover = true
+		for _, param := range ext[1:] {
+			name, _, _ := strings.Cut(param, "=")
+			switch name {
+			case "server_no_context_takeover":
+				conn.takeover = false
+			case "client_no_context_takeover", "server_max_window_bits":
+			default:
+				return errors.New("unsupported extension parameter:" + name)
+			}
+		}
+	}
+
+	return nil
 }
 
 func (conn *Conn) WriteJSON(val interface{}) error {
@@ -160,16 +232,44 @@ func (conn *Conn) WriteJSON(val interface{}) error {
 		return err
 	}
 
-	_, err = (&writer{conn.writer, Text}).Write(jsn)
+	return conn.data(Text, jsn)
+}
+
+func (conn *Conn) WriteMessage(typ int, data []byte) error {
+
+	conn.write.Lock()
+	defer conn.write.Unlock()
+
+	if typ != Text && typ != Binary {
+		return conn.put(true, typ, data)
+	}
+
+	return conn.data(typ, data)
+}
+
+func (conn *Conn) data(typ int, data []byte) error {
+	if !conn.deflate {
+		return conn.put(true, typ, data)
+	}
+
+	buf := new(bytes.Buffer)
+
+	zip, err := flate.NewWriter(buf, flate.DefaultCompression)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	_, err = zip.Write(data)
+	if err != nil {
+		return err
+	}
 
-func (conn *Conn) Close() error {
-	return conn.conn.Close()
+	err = zip.Flush()
+	if err != nil {
+		return err
+	}
+
+	return conn.put(true, typ|rsv1, bytes.TrimSuffix(buf.Bytes(), suffix))
 }
 
 func (conn *Conn) WriteClose(code int) error {
@@ -177,129 +277,271 @@ func (conn *Conn) WriteClose(code int) error {
 	conn.write.Lock()
 	defer conn.write.Unlock()
 
+	conn.sent = true
+
 	stt := make([]byte, 2)
 	binary.BigEndian.PutUint16(stt, uint16(code))
 
-	_, err := (&writer{conn.writer, Close}).Write(stt)
+	return conn.put(true, Close, stt)
+}
+
+func (conn *Conn) Close() error {
+	if conn.pipe != nil {
+		conn.pipe.close()
+	}
+
+	return conn.conn.Close()
+}
+
+func (conn *Conn) SetReadDeadline(deadline time.Time) error {
+	return conn.conn.SetReadDeadline(deadline)
+}
+
+func (conn *Conn) SetWriteDeadline(deadline time.Time) error {
+	return conn.conn.SetWriteDeadline(deadline)
+}
+
+func (conn *Conn) SetReadLimit(limit int64) {
+
+	conn.read.Lock()
+	defer conn.read.Unlock()
+
+	if limit <= 0 {
+		limit = max
+	}
+	conn.limit = limit
+}
+
+func (conn *Conn) ReadJSON(val interface{}) error {
+
+	conn.read.Lock()
+	defer conn.read.Unlock()
+
+	op, data, err := conn.message()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if op == Binary {
+		if conn.stream {
+			data, err = conn.inflate(data)
+			if err != nil {
+				return err
+			}
+
+			return json.Unmarshal(data, val)
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		return json.NewDecoder(reader).Decode(val)
+	}
+
+	return json.Unmarshal(data, val)
 }
 
-func (writer *writer) Write(val []byte) (int, error) {
-	key := make([]byte, 4)
+func (conn *Conn) ReadMessage() (int, []byte, error) {
 
-	_, err := io.ReadFull(rand.Reader, key)
+	conn.read.Lock()
+	defer conn.read.Unlock()
+
+	op, data, err := conn.message()
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	if op == Binary && conn.stream {
+		data, err = conn.inflate(data)
+		if err != nil {
+			return 0, nil, err
+		}
 	}
 
-	var header []byte
-	var byt byte
+	return op, data, nil
+}
+
+func (conn *Conn) inflate(data []byte) ([]byte, error) {
+	for !bytes.HasSuffix(data, suffix) {
+		op, more, err := conn.message()
+		if err != nil {
+			return nil, err
+		}
+		if op != Binary {
+			return nil, errors.New("unexpected op code in zlib stream:" + strconv.Itoa(op))
+		}
+		if int64(len(data)+len(more)) > conn.limit {
+			return nil, errors.New("message length too large")
+		}
 
-	byt = 0x80
-	byt |= byte(writer.typ)
-	header = append(header, byt)
+		data = append(data, more...)
+	}
 
-	byt = 0x80
-	var fields int
-	switch {
-	case len(val) <= 125:
-		byt |= byte(len(val))
-	case len(val) < 65536:
-		byt |= 126
-		fields = 2
-	default:
-		byt |= 127
-		fields = 8
+	select {
+	case conn.pipe.in <- data:
+	case <-conn.pipe.out:
+		return nil, conn.pipe.fail()
 	}
-	header = append(header, byt)
 
-	for idx := 0; idx < fields; idx++ {
-		byt = byte((len(val) >> uint((fields-idx-1)*8)) & 0xff)
-		header = append(header, byt)
+	var out []byte
+	var large bool
+	for {
+		more, ok := <-conn.pipe.out
+		if !ok {
+			return nil, conn.pipe.fail()
+		}
+		if more == nil {
+			break
+		}
+
+		if int64(len(out)+len(more)) > conn.limit {
+			large = true
+			continue
+		}
+		out = append(out, more...)
 	}
-	header = append(header, key...)
 
-	writer.buf.Write(header)
-	data := make([]byte, len(val))
-	for idx := range data {
-		data[idx] = val[idx] ^ key[idx%4]
+	if large {
+		return nil, errors.New("message length too large")
 	}
-	writer.buf.Write(data)
 
-	return len(val) + len(header), writer.buf.Flush()
+	return out, nil
 }
 
-func (conn *Conn) ReadJSON(val interface{}) error {
+func newPipe() *pipe {
+	pipe := &pipe{
+		in:   make(chan []byte),
+		out:  make(chan []byte),
+		done: make(chan struct{}),
+		once: new(sync.Once),
+	}
 
-	conn.read.Lock()
-	defer conn.read.Unlock()
+	go pipe.run()
+
+	return pipe
+}
 
-	var header []byte
-	var byt byte
+func (pipe *pipe) run() {
+	defer close(pipe.out)
 
-	byt, err := conn.reader.ReadByte()
+	inflater, err := zlib.NewReader(pipe)
 	if err != nil {
-		return err
+		pipe.err = err
+		return
+	}
+	defer inflater.Close()
+
+	buf := make([]byte, chunk)
+	for {
+		n, err := inflater.Read(buf)
+		if n > 0 {
+			select {
+			case pipe.out <- append([]byte(nil), buf[:n]...):
+			case <-pipe.done:
+				return
+			}
+		}
+		if err != nil {
+			pipe.err = err
+			return
+		}
 	}
-	header = append(header, byt)
+}
 
-	byt, err = conn.reader.ReadByte()
-	if err != nil {
-		return err
+func (pipe *pipe) fill() error {
+	if pipe.fed {
+		select {
+		case pipe.out <- nil:
+		case <-pipe.done:
+			return io.ErrClosedPipe
+		}
 	}
-	header = append(header, byt)
-	byt &= 0x7f
 
-	var ln int64
-	var fields int
-	switch {
-	case byt <= 125:
-		ln = int64(byt)
-	case byt == 126:
-		fields = 2
-	case byt == 127:
-		fields = 8
+	select {
+	case pipe.buf = <-pipe.in:
+		pipe.fed = true
+		return nil
+	case <-pipe.done:
+		return io.ErrClosedPipe
 	}
+}
 
-	for idx := 0; idx < fields; idx++ {
-		byt, err = conn.reader.ReadByte()
+func (pipe *pipe) Read(data []byte) (int, error) {
+	for len(pipe.buf) == 0 {
+		err := pipe.fill()
 		if err != nil {
-			return err
+			return 0, err
 		}
-		if fields == 8 && idx == 0 {
-			byt &= 0x7f
+	}
+
+	n := copy(data, pipe.buf)
+	pipe.buf = pipe.buf[n:]
+
+	return n, nil
+}
+
+func (pipe *pipe) ReadByte() (byte, error) {
+	for len(pipe.buf) == 0 {
+		err := pipe.fill()
+		if err != nil {
+			return 0, err
 		}
-		header = append(header, byt)
-		ln = ln*256 + int64(byt)
 	}
 
-	if ln > max {
-		return errors.New("frame length too large")
+	byt := pipe.buf[0]
+	pipe.buf = pipe.buf[1:]
+
+	return byt, nil
+}
+
+func (pipe *pipe) fail() error {
+	if pipe.err == nil || pipe.err == io.EOF {
+		return errors.New("zlib stream closed")
 	}
 
-	reader := io.LimitReader(conn.reader, ln)
+	return pipe.err
+}
 
-	op := header[0] & 0x0f
-	switch op {
-	case Text:
-	case Binary:
-		reader, err = zlib.NewReader(reader)
-		if err != nil {
-			return err
+func (pipe *pipe) close() {
+	pipe.once.Do(func() {
+		close(pipe.done)
+	})
+}
+
+func (conn *Conn) decompress(data []byte) ([]byte, error) {
+	var dict []byte
+	if conn.takeover {
+		dict = conn.prev
+	}
+
+	inflater := flate.NewReaderDict(io.MultiReader(bytes.NewReader(data), bytes.NewReader(suffix), bytes.NewReader(final)), dict)
+	defer inflater.Close()
+
+	out, err := io.ReadAll(io.LimitReader(inflater, conn.limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > conn.limit {
+		return nil, errors.New("message length too large")
+	}
+
+	if conn.takeover {
+		conn.prev = append(conn.prev, out...)
+		if len(conn.prev) > window {
+			conn.prev = append([]byte(nil), conn.prev[len(conn.prev)-window:]...)
 		}
-	case Close:
-		return io.EOF
-	default:
-		return errors.New("unknown op code:" + strconv.Itoa(int(op)))
 	}
 
-	if closer, ok := reader.(io.ReadCloser); ok {
-		defer closer.Close()
+	return out, nil
+}
+
+func (err *CloseError) Error() string {
+	if err.Reason == "" {
+		return "websocket closed:" + strconv.Itoa(err.Code)
 	}
 
-	return json.NewDecoder(reader).Decode(val)
+	return "websocket closed:" + strconv.Itoa(err.Code) + " " + err.Reason
 }
@@ -0,0 +1,103 @@
+package socket
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net"
+	"strings"
+	"testing"
+)
+
+func frame(op int, data []byte) []byte {
+	buf := []byte{0x80 | byte(op)}
+	switch {
+	case len(data) < 126:
+		buf = append(buf, byte(len(data)))
+	default:
+		buf = append(buf, 126, byte(len(data)>>8), byte(len(data)))
+	}
+
+	return append(buf, data...)
+}
+
+func TestZlibStream(t *testing.T) {
+	raw, peer := net.Pipe()
+	defer peer.Close()
+
+	conn := newConn(raw)
+	conn.stream = true
+	conn.pipe = newPipe()
+	defer conn.Close()
+
+	msgs := []string{
+		`{"op":10,"d":{"heartbeat_interval":41250}}`,
+		`{"op":0,"t":"READY","d":{"v":10}}`,
+		strings.Repeat(`{"op":0,"t":"GUILD_CREATE"}`, 40),
+		`{"op":11}`,
+	}
+
+	go func() {
+		buf := new(bytes.Buffer)
+		writer := zlib.NewWriter(buf)
+		for idx, msg := range msgs {
+			writer.Write([]byte(msg))
+			writer.Flush()
+
+			data := buf.Bytes()
+			if idx == 2 {
+				half := len(data) / 2
+				peer.Write(frame(Binary, data[:half]))
+				peer.Write(frame(Binary, data[half:]))
+			} else {
+				peer.Write(frame(Binary, data))
+			}
+			buf.Reset()
+		}
+	}()
+
+	for _, msg := range msgs {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != Binary || string(data) != msg {
+			t.Fatalf("got %d %q want %q", op, data, msg)
+		}
+	}
+}
+
+func TestZlibStreamLimit(t *testing.T) {
+	raw, peer := net.Pipe()
+	defer peer.Close()
+
+	conn := newConn(raw)
+	conn.stream = true
+	conn.pipe = newPipe()
+	conn.limit = 32
+	defer conn.Close()
+
+	go func() {
+		buf := new(bytes.Buffer)
+		writer := zlib.NewWriter(buf)
+		writer.Write([]byte(strings.Repeat("a", 1024)))
+		writer.Flush()
+		peer.Write(frame(Binary, buf.Bytes()))
+	}()
+
+	_, _, err := conn.ReadMessage()
+	if err == nil || err.Error() != "message length too large" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDialStream(t *testing.T) {
+	client, _ := pair(t, &Dialer{}, nil)
+	if client.stream || client.pipe != nil {
+		t.Error("plain dialer enabled zlib stream")
+	}
+
+	client, _ = pair(t, &Dialer{Stream: true}, nil)
+	if !client.stream || client.pipe == nil {
+		t.Error("stream dialer did not enable zlib stream")
+	}
+}